@@ -1,5 +1,13 @@
 module github.com/arabian9ts/builder
 
-go 1.13
+go 1.22.0
 
-require github.com/dave/jennifer v1.4.0
+require (
+	github.com/dave/jennifer v1.7.1
+	golang.org/x/tools v0.30.0
+)
+
+require (
+	golang.org/x/mod v0.23.0 // indirect
+	golang.org/x/sync v0.11.0 // indirect
+)
@@ -1,38 +1,331 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 
+	"github.com/arabian9ts/builder/pkg/builder"
 	"github.com/arabian9ts/builder/pkg/fileoperator"
 )
 
-func genBuilder(targetPkg string) {
-	fmt.Println(">>> Generating Builder ...")
-	err := fileoperator.CreateBuilder(targetPkg)
+const (
+	EXIT_OK      = 0
+	EXIT_FAILURE = 1
+	EXIT_USAGE   = 2
+	EXIT_STALE   = 3
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+var commands = []command{
+	{"generate", "generate builders, accessors and options", runGenerate},
+	{"clean", "remove generated files", runClean},
+	{"check", "fail when generated files are out of date, without writing anything", runCheck},
+	{"list", "list the structs and the files generated for them", runList},
+}
+
+// output holds the flags every subcommand shares.
+type output struct {
+	only    string
+	verbose bool
+	quiet   bool
+}
+
+func (out *output) register(fs *flag.FlagSet) {
+	fs.StringVar(&out.only, "only", "", "comma separated kinds of generated files to handle: "+strings.Join(fileoperator.KINDS, ", "))
+	fs.BoolVar(&out.verbose, "verbose", false, "print every file handled")
+	fs.BoolVar(&out.quiet, "quiet", false, "print errors only")
+}
+
+func (out output) kinds() ([]string, error) {
+	if out.only == "" {
+		return fileoperator.KINDS, nil
+	}
+
+	kinds := make([]string, 0)
+	for _, kind := range strings.Split(out.only, ",") {
+		kind = strings.TrimSpace(kind)
+		known := false
+		for _, k := range fileoperator.KINDS {
+			known = known || k == kind
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown kind %q, expected one of %s", kind, strings.Join(fileoperator.KINDS, ", "))
+		}
+		kinds = append(kinds, kind)
+	}
+
+	return kinds, nil
+}
+
+func (out output) progress(format string, args ...interface{}) {
+	if !out.quiet {
+		fmt.Printf(format+"\n", args...)
+	}
+}
+
+func (out output) detail(format string, args ...interface{}) {
+	if out.verbose && !out.quiet {
+		fmt.Printf(format+"\n", args...)
+	}
+}
+
+// fail reports every error joined into err, one per line, and returns the
+// exit code for it.
+func (out output) fail(err error) int {
+	var joined interface{ Unwrap() []error }
+	if errors.As(err, &joined) {
+		for _, e := range joined.Unwrap() {
+			out.fail(e)
+		}
+		return EXIT_FAILURE
+	}
+
+	fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+	return EXIT_FAILURE
+}
+
+// generation holds the flags of the subcommands running the generator.
+type generation struct {
+	conf        builder.Config
+	naming      string
+	initialisms string
+}
+
+func (gen *generation) register(fs *flag.FlagSet) {
+	fs.BoolVar(&gen.conf.Validate, "validate", false, "call the validate method of built entities in Build")
+	fs.StringVar(&gen.conf.ValidateMethod, "validate-method", builder.DEFAULT_VALIDATE_METHOD, "name of the `func() error` method called by Build")
+	fs.BoolVar(&gen.conf.Options, "options", false, "generate functional options for every struct")
+	fs.BoolVar(&gen.conf.Step, "step", false, "generate step builders enforcing required fields at compile time")
+	fs.BoolVar(&gen.conf.Clone, "clone", false, "generate deep Clone methods for every struct")
+	fs.BoolVar(&gen.conf.Equal, "equal", false, "generate Equal and Diff methods for every struct")
+	fs.BoolVar(&gen.conf.Exported, "exported", false, "include exported fields in builders")
+	fs.StringVar(&gen.naming, "naming", builder.IDIOMATIC_NAMING, "naming of generated identifiers, idiomatic or legacy")
+	fs.StringVar(&gen.initialisms, "initialisms", "", "comma separated initialisms kept in a single case, in addition to the common ones")
+	fs.StringVar(&gen.conf.OnConflict, "on-conflict", builder.CONFLICT_SKIP, "what to do with a generated method whose name is taken, skip or error")
+}
+
+func (gen *generation) config() (builder.Config, error) {
+	var extra []string
+	if gen.initialisms != "" {
+		extra = strings.Split(gen.initialisms, ",")
+	}
+	strategy, err := builder.NamingStrategy(gen.naming, extra)
 	if err != nil {
-		panic(err)
+		return builder.Config{}, err
+	}
+	gen.conf.Naming = strategy
+
+	if gen.conf.OnConflict != builder.CONFLICT_SKIP && gen.conf.OnConflict != builder.CONFLICT_ERROR {
+		return builder.Config{}, fmt.Errorf("unknown conflict policy %q, expected %q or %q",
+			gen.conf.OnConflict, builder.CONFLICT_SKIP, builder.CONFLICT_ERROR)
+	}
+
+	return gen.conf, nil
+}
+
+// invocation is a subcommand with its arguments parsed.
+type invocation struct {
+	output
+	dryRun   bool
+	patterns []string
+	kinds    []string
+	conf     builder.Config
+}
+
+// parse parses the arguments of the subcommand name, along with the flags of
+// the generator when generates is set. it reports false with the exit code
+// when there is nothing to run.
+func parse(name string, args []string, generates bool) (invocation, int, bool) {
+	inv := invocation{}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "[USAGE]: builder %s [flags] <Package Pattern>...\n", name)
+		fs.PrintDefaults()
+	}
+	inv.output.register(fs)
+	gen := generation{}
+	if generates {
+		gen.register(fs)
+	}
+	if name == "generate" {
+		fs.BoolVar(&inv.dryRun, "dry-run", false, "print a unified diff of the changes instead of writing them")
+		fs.BoolVar(&inv.dryRun, "diff", false, "same as -dry-run")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return inv, EXIT_OK, false
+		}
+		return inv, EXIT_USAGE, false
+	}
+
+	usageError := func(err error) (invocation, int, bool) {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		return inv, EXIT_USAGE, false
 	}
 
-	fmt.Println(">>> Generating Accessor ...")
-	err = fileoperator.CreateAccessor(targetPkg)
+	kinds, err := inv.output.kinds()
 	if err != nil {
-		panic(err)
+		return usageError(err)
 	}
+	inv.kinds = kinds
+	if generates {
+		if inv.conf, err = gen.config(); err != nil {
+			return usageError(err)
+		}
+	}
+	if fs.NArg() <= 0 {
+		return usageError(errors.New("package is not specified"))
+	}
+	inv.patterns = fs.Args()
 
-	fmt.Println("Generate Completed")
+	if inv.quiet {
+		builder.Notices = io.Discard
+	}
+
+	return inv, EXIT_OK, true
+}
+
+func runGenerate(args []string) int {
+	inv, code, ok := parse("generate", args, true)
+	if !ok {
+		return code
+	}
+	if inv.dryRun {
+		return runDiff(inv)
+	}
+
+	inv.progress(">>> Generating %s ...", strings.Join(inv.kinds, ", "))
+	written, removed, err := fileoperator.Generate(inv.patterns, inv.kinds, inv.conf)
+	for _, fileName := range written {
+		inv.detail("wrote %s", fileName)
+	}
+	for _, fileName := range removed {
+		inv.detail("removed %s", fileName)
+	}
+	if err != nil {
+		return inv.fail(err)
+	}
+
+	inv.progress("Generate Completed")
+	return EXIT_OK
+}
+
+func runDiff(inv invocation) int {
+	diffs, err := fileoperator.Diff(inv.patterns, inv.kinds, inv.conf)
+	for _, diff := range diffs {
+		fmt.Print(diff)
+	}
+	if err != nil {
+		return inv.fail(err)
+	}
+
+	return EXIT_OK
+}
+
+func runClean(args []string) int {
+	inv, code, ok := parse("clean", args, false)
+	if !ok {
+		return code
+	}
+
+	inv.progress(">>> Cleaning %s ...", strings.Join(inv.kinds, ", "))
+	removed, err := fileoperator.CleanBuilder(inv.patterns, inv.kinds)
+	for _, fileName := range removed {
+		inv.detail("removed %s", fileName)
+	}
+	if err != nil {
+		return inv.fail(err)
+	}
+
+	inv.progress("Clean Completed")
+	return EXIT_OK
+}
+
+func runCheck(args []string) int {
+	inv, code, ok := parse("check", args, true)
+	if !ok {
+		return code
+	}
+
+	inv.progress(">>> Checking %s ...", strings.Join(inv.kinds, ", "))
+	stale, err := fileoperator.Check(inv.patterns, inv.kinds, inv.conf)
+	for _, file := range stale {
+		fmt.Printf("%s\t%s\n", file.Reason, file.Path)
+	}
+	if err != nil {
+		return inv.fail(err)
+	}
+	if 0 < len(stale) {
+		fmt.Fprintf(os.Stderr, "%d generated files are out of date, run builder generate\n", len(stale))
+		return EXIT_STALE
+	}
+
+	inv.progress("Check Completed")
+	return EXIT_OK
+}
+
+func runList(args []string) int {
+	inv, code, ok := parse("list", args, true)
+	if !ok {
+		return code
+	}
+
+	listings, err := fileoperator.List(inv.patterns, inv.kinds, inv.conf)
+	for _, listing := range listings {
+		if len(listing.Structs) <= 0 && !inv.verbose {
+			continue
+		}
+		fmt.Printf("%s\t%s\n", listing.Source, strings.Join(listing.Structs, ", "))
+		for _, fileName := range listing.Generated {
+			inv.detail("\t-> %s", fileName)
+		}
+	}
+	if err != nil {
+		return inv.fail(err)
+	}
+
+	return EXIT_OK
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "[USAGE]: builder <command> [flags] <Package Pattern>...")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s%s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nWithout a command, builder generates. Run builder <command> -h for its flags.")
 }
 
 func main() {
-	buildTarget := os.Args[1:]
+	args := os.Args[1:]
+	if len(args) <= 0 {
+		usage()
+		os.Exit(EXIT_USAGE)
+	}
 
-	if len(buildTarget) <= 0 {
-		fmt.Println("ackage is not specified")
-		fmt.Println("[USAGE]: builder <Package Name>")
-		os.Exit(1)
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		usage()
+		os.Exit(EXIT_OK)
 	}
 
-	for i := range buildTarget {
-		genBuilder(buildTarget[i])
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			os.Exit(cmd.run(args[1:]))
+		}
 	}
+
+	// bare package patterns keep generating, as before subcommands existed
+	os.Exit(runGenerate(args))
 }
@@ -0,0 +1,314 @@
+package builder
+
+import (
+	"fmt"
+	"go/types"
+	"reflect"
+
+	. "github.com/dave/jennifer/jen"
+)
+
+const (
+	CLONE_TAG_VALUE = "clone"
+	CLONE_DIRECTIVE = "clone"
+
+	CLONE_SHALLOW = "shallow"
+	CLONE_SKIP    = "-"
+)
+
+func (st PkgStruct) generatesClone() bool {
+	return generatesClone(st.conf, st.directives)
+}
+
+func generatesClone(conf Config, directives Directives) bool {
+	if conf.Clone {
+		return true
+	}
+
+	_, found := directives.Lookup(CLONE_DIRECTIVE)
+	return found
+}
+
+// DefineClone emits a Clone method copying slices, maps, pointers and nested
+// structs, so that the copy shares no mutable state with the original.
+// `clone:"shallow"` copies a field by assignment and `clone:"-"` leaves it zero.
+func (st PkgStruct) DefineClone(file *File) error {
+	if !st.generatesClone() {
+		return nil
+	}
+	ok, err := st.claim(st.name, "Clone", st.named.Obj().Pos(), true)
+	if err != nil || !ok {
+		return err
+	}
+
+	receiver := st.entityReceiverName()
+	cloned := distinctName(st.local("cloned"), receiver)
+	body := []Code{
+		If(Id(receiver).Op("==").Nil()).Block(
+			Return(Nil()),
+		),
+		Line(),
+		Id(cloned).Op(":=").Op("*").Id(receiver),
+	}
+
+	for i := 0; i < st.meta.NumFields(); i++ {
+		field := st.meta.Field(i)
+		if field.Name() == "_" {
+			continue
+		}
+
+		mode, _ := reflect.StructTag(st.meta.Tag(i)).Lookup(CLONE_TAG_VALUE)
+		switch mode {
+		case "":
+			cl := st.newCloner()
+			if !cl.needsDeepCopy(field.Type()) {
+				continue
+			}
+			body = append(body,
+				Id(cloned).Dot(field.Name()).Op("=").Add(cl.cloneExpr(Id(receiver).Dot(field.Name()), field.Type())),
+			)
+		case CLONE_SHALLOW:
+			continue
+		case CLONE_SKIP:
+			body = append(body,
+				Id(cloned).Dot(field.Name()).Op("=").Add(zeroValue(field.Type())),
+			)
+		default:
+			return fmt.Errorf("%s: invalid %s tag of %s: %q, expected %q or %q",
+				st.fset.Position(field.Pos()), CLONE_TAG_VALUE, field.Name(), mode, CLONE_SHALLOW, CLONE_SKIP)
+		}
+	}
+	body = append(body, Return(Op("&").Id(cloned)))
+
+	entityType := Op("*").Id(st.name).Types(st.typeArgs()...)
+	file.Func().Params(Id(receiver).Add(entityType.Clone())).
+		Id("Clone").
+		Params().
+		Params(entityType.Clone()).
+		Block(body...).
+		Line()
+
+	return nil
+}
+
+type cloner struct {
+	st PkgStruct
+	// visiting guards against self-referential types being expanded forever
+	visiting map[*types.TypeName]bool
+}
+
+func (st PkgStruct) newCloner() *cloner {
+	return &cloner{
+		st:       st,
+		visiting: map[*types.TypeName]bool{st.named.Obj(): true},
+	}
+}
+
+// id refers to the local name of closures in the copy code.
+func (cl *cloner) id(name string) *Statement {
+	return Id(cl.st.local(name))
+}
+
+func (cl *cloner) needsDeepCopy(t types.Type) bool {
+	if named, ok := t.(*types.Named); ok {
+		if _, found := cl.cloneMethod(named); found {
+			return true
+		}
+		if cl.visiting[named.Obj()] || !inlinable(cl.st.pkg, named) {
+			return false
+		}
+
+		cl.visiting[named.Obj()] = true
+		defer delete(cl.visiting, named.Obj())
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Pointer, *types.Slice, *types.Map:
+		return true
+	case *types.Array:
+		return cl.needsDeepCopy(u.Elem())
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			if cl.needsDeepCopy(u.Field(i).Type()) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// cloneExpr renders an expression evaluating to a deep copy of src. src must
+// be addressable, so that pointer receiver Clone methods can be called on it.
+func (cl *cloner) cloneExpr(src Code, t types.Type) Code {
+	if !cl.needsDeepCopy(t) {
+		return src
+	}
+
+	if named, ok := t.(*types.Named); ok {
+		if onPointer, found := cl.cloneMethod(named); found {
+			if onPointer {
+				return Op("*").Add(src).Dot("Clone").Call()
+			}
+			return Add(src).Dot("Clone").Call()
+		}
+
+		cl.visiting[named.Obj()] = true
+		defer delete(cl.visiting, named.Obj())
+	}
+
+	typ := typeCode(t)
+	switch u := t.Underlying().(type) {
+	case *types.Pointer:
+		return cl.clonePointer(src, typ, u)
+	case *types.Slice:
+		fill := Id("copy").Call(cl.id("c"), cl.id("s"))
+		if cl.needsDeepCopy(u.Elem()) {
+			fill = For(cl.id("i").Op(":=").Range().Add(cl.id("s"))).Block(
+				cl.id("c").Index(cl.id("i")).Op("=").Add(cl.cloneExpr(cl.id("s").Index(cl.id("i")), u.Elem())),
+			)
+		}
+		return Func().Params(cl.id("s").Add(typ)).Add(typ).Block(
+			If(cl.id("s").Op("==").Nil()).Block(Return(Nil())),
+			cl.id("c").Op(":=").Make(typ, Len(cl.id("s"))),
+			fill,
+			Return(cl.id("c")),
+		).Call(src)
+	case *types.Map:
+		return Func().Params(cl.id("m").Add(typ)).Add(typ).Block(
+			If(cl.id("m").Op("==").Nil()).Block(Return(Nil())),
+			cl.id("c").Op(":=").Make(typ, Len(cl.id("m"))),
+			For(List(cl.id("k"), cl.id("v")).Op(":=").Range().Add(cl.id("m"))).Block(
+				cl.id("c").Index(cl.id("k")).Op("=").Add(cl.cloneExpr(cl.id("v"), u.Elem())),
+			),
+			Return(cl.id("c")),
+		).Call(src)
+	case *types.Array:
+		return Func().Params(cl.id("a").Add(typ)).Add(typ).Block(
+			For(cl.id("i").Op(":=").Range().Add(cl.id("a"))).Block(
+				cl.id("a").Index(cl.id("i")).Op("=").Add(cl.cloneExpr(cl.id("a").Index(cl.id("i")), u.Elem())),
+			),
+			Return(cl.id("a")),
+		).Call(src)
+	case *types.Struct:
+		body := make([]Code, 0, u.NumFields()+1)
+		for i := 0; i < u.NumFields(); i++ {
+			field := u.Field(i)
+			if field.Name() == "_" || !cl.needsDeepCopy(field.Type()) {
+				continue
+			}
+			body = append(body,
+				cl.id("v").Dot(field.Name()).Op("=").Add(cl.cloneExpr(cl.id("v").Dot(field.Name()), field.Type())),
+			)
+		}
+		body = append(body, Return(cl.id("v")))
+		return Func().Params(cl.id("v").Add(typ)).Add(typ).Block(body...).Call(src)
+	}
+
+	return src
+}
+
+func (cl *cloner) clonePointer(src Code, typ Code, t *types.Pointer) Code {
+	elem := t.Elem()
+	body := []Code{
+		If(cl.id("p").Op("==").Nil()).Block(Return(Nil())),
+	}
+
+	named, isNamed := elem.(*types.Named)
+	onPointer, found := false, false
+	if isNamed {
+		onPointer, found = cl.cloneMethod(named)
+	}
+
+	switch {
+	case found && onPointer:
+		body = append(body, Return(cl.id("p").Dot("Clone").Call()))
+	case found:
+		body = append(body,
+			cl.id("c").Op(":=").Add(cl.id("p")).Dot("Clone").Call(),
+			Return(Op("&").Add(cl.id("c"))),
+		)
+	default:
+		body = append(body,
+			cl.id("c").Op(":=").Add(cl.cloneExpr(Op("*").Add(cl.id("p")), elem)),
+			Return(Op("&").Add(cl.id("c"))),
+		)
+	}
+
+	return Func().Params(cl.id("p").Add(typ)).Add(typ).Block(body...).Call(src)
+}
+
+// cloneMethod finds a `Clone() T` or `Clone() *T` method of t, either
+// generated in this run or hand-written.
+func (cl *cloner) cloneMethod(t *types.Named) (onPointer bool, found bool) {
+	obj := t.Obj()
+	if obj.Pkg() == cl.st.pkg && cl.st.index.declares(obj) {
+		if _, ok := t.Underlying().(*types.Struct); ok && generatesClone(cl.st.conf, cl.st.index.directivesOf(obj)) {
+			return true, true
+		}
+	}
+
+	method, _, _ := types.LookupFieldOrMethod(types.NewPointer(t), false, obj.Pkg(), "Clone")
+	fn, ok := method.(*types.Func)
+	if !ok {
+		return false, false
+	}
+	if fn.Pkg() == cl.st.pkg && !cl.st.index.isHandWritten(fn) {
+		return false, false
+	}
+
+	sig := fn.Type().(*types.Signature)
+	if sig.Params().Len() != 0 || sig.Results().Len() != 1 {
+		return false, false
+	}
+
+	result := sig.Results().At(0).Type()
+	switch {
+	case types.Identical(result, t):
+		return false, true
+	case types.Identical(result, types.NewPointer(t)):
+		return true, true
+	}
+
+	return false, false
+}
+
+// inlinable reports whether a named struct can be handled field by field
+// from code generated into pkg, which needs access to every field.
+func inlinable(pkg *types.Package, t *types.Named) bool {
+	st, ok := t.Underlying().(*types.Struct)
+	if !ok || t.Obj().Pkg() == pkg {
+		return true
+	}
+
+	for i := 0; i < st.NumFields(); i++ {
+		if !st.Field(i).Exported() {
+			return false
+		}
+	}
+
+	return true
+}
+
+func zeroValue(t types.Type) Code {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsBoolean != 0:
+			return False()
+		case u.Info()&types.IsString != 0:
+			return Lit("")
+		case u.Info()&types.IsNumeric != 0:
+			return Lit(0)
+		}
+		return Nil()
+	case *types.Struct, *types.Array:
+		return Add(typeCode(t)).Values()
+	case *types.Interface:
+		if _, ok := t.(*types.TypeParam); ok {
+			return Op("*").New(typeCode(t))
+		}
+	}
+
+	return Nil()
+}
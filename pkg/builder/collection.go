@@ -0,0 +1,150 @@
+package builder
+
+import (
+	"fmt"
+	"go/types"
+	"strings"
+
+	. "github.com/dave/jennifer/jen"
+)
+
+func isCollection(t types.Type) bool {
+	switch t.Underlying().(type) {
+	case *types.Slice, *types.Map:
+		return true
+	}
+
+	return false
+}
+
+// singularName is the element name used by the collection helpers of field,
+// either given with `build:",singular=Name"` or derived from the field name.
+// fields whose name has no plural form get no helpers.
+func (f Field) singularName() (string, bool) {
+	if f.opts.Singular != "" {
+		return f.naming.Exported(f.opts.Singular), true
+	}
+
+	plural := f.naming.Exported(f.Name())
+	switch {
+	case strings.HasSuffix(plural, "ies") && len(plural) > 3:
+		return strings.TrimSuffix(plural, "ies") + "y", true
+	case strings.HasSuffix(plural, "sses"),
+		strings.HasSuffix(plural, "xes"),
+		strings.HasSuffix(plural, "ches"),
+		strings.HasSuffix(plural, "shes"):
+		return strings.TrimSuffix(plural, "es"), true
+	case strings.HasSuffix(plural, "ss"):
+		return "", false
+	case strings.HasSuffix(plural, "s") && len(plural) > 1:
+		return strings.TrimSuffix(plural, "s"), true
+	}
+
+	return "", false
+}
+
+// detached renders value of field so that it shares no storage the builder
+// writes into: PutX writes into the map in place, so maps with the helper are
+// copied between the builder and entities. AddX never appends in place.
+func (st PkgStruct) detached(field Field, value *Statement) *Statement {
+	if st.generatesStepBuilder() {
+		return value
+	}
+	if _, ok := field.Type().Underlying().(*types.Map); !ok {
+		return value
+	}
+	if _, found := field.singularName(); !found {
+		return value
+	}
+
+	return Qual("maps", "Clone").Call(value)
+}
+
+// defineCollectionHelpers emits AddX and AddXs for slice fields and PutX for
+// map fields, so that collections can be filled one element at a time.
+func (st PkgStruct) defineCollectionHelpers(file *File, field Field) error {
+	singular, found := field.singularName()
+	if !found {
+		return nil
+	}
+
+	builderType := Op("*").Id(st.builderName()).Types(st.typeArgs()...)
+	receiver := st.receiverName()
+	target := Id(receiver).Op(".").Id(field.stateName())
+
+	assigned := Null()
+	if field.opts.Required {
+		assigned = Id(receiver).Op(".").Id(ASSIGNED_FIELD).Op(".").Id(field.Name()).Op("=").True()
+	}
+
+	switch u := field.Type().Underlying().(type) {
+	case *types.Slice:
+		element := parameterName(field.naming.Unexported(singular), receiver, st.fset.Position(field.Pos()))
+		elements := st.argumentName(field, receiver)
+		if element == elements {
+			return nil
+		}
+
+		adder, err := st.claim(st.builderName(), fmt.Sprintf("Add%s", singular), field.Pos(), true)
+		if err != nil {
+			return err
+		}
+		variadicAdder, err := st.claim(st.builderName(), fmt.Sprintf("Add%s", field.naming.Exported(field.Name())), field.Pos(), true)
+		if err != nil {
+			return err
+		}
+
+		// appending to the clipped slice always moves it to a new array, which
+		// keeps entities built earlier and seeded ToBuilder apart
+		clipped := target.Clone().Index(Empty(), Len(target.Clone()), Len(target.Clone()))
+
+		if adder {
+			file.Func().Params(Id(receiver).Add(builderType.Clone())).
+				Id(fmt.Sprintf("Add%s", singular)).
+				Params(Id(element).Add(typeCode(u.Elem()))).
+				Params(builderType.Clone()).
+				Block(
+					Add(target.Clone()).Op("=").Append(clipped.Clone(), Id(element)),
+					assigned,
+					Return(Id(receiver)),
+				).
+				Line()
+		}
+
+		if variadicAdder {
+			file.Func().Params(Id(receiver).Add(builderType.Clone())).
+				Id(fmt.Sprintf("Add%s", field.naming.Exported(field.Name()))).
+				Params(Id(elements).Op("...").Add(typeCode(u.Elem()))).
+				Params(builderType.Clone()).
+				Block(
+					Add(target.Clone()).Op("=").Append(clipped.Clone(), Id(elements).Op("...")),
+					assigned,
+					Return(Id(receiver)),
+				).
+				Line()
+		}
+	case *types.Map:
+		ok, err := st.claim(st.builderName(), fmt.Sprintf("Put%s", singular), field.Pos(), true)
+		if err != nil || !ok {
+			return err
+		}
+
+		key := distinctName(st.local("key"), receiver)
+		value := distinctName(st.local("value"), receiver)
+		file.Func().Params(Id(receiver).Add(builderType.Clone())).
+			Id(fmt.Sprintf("Put%s", singular)).
+			Params(Id(key).Add(typeCode(u.Key())), Id(value).Add(typeCode(u.Elem()))).
+			Params(builderType.Clone()).
+			Block(
+				If(target.Clone().Op("==").Nil()).Block(
+					Add(target.Clone()).Op("=").Make(typeCode(field.Type())),
+				),
+				Add(target.Clone()).Index(Id(key)).Op("=").Id(value),
+				assigned,
+				Return(Id(receiver)),
+			).
+			Line()
+	}
+
+	return nil
+}
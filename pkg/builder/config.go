@@ -0,0 +1,52 @@
+package builder
+
+const DEFAULT_VALIDATE_METHOD = "Validate"
+
+type Config struct {
+	// Validate makes every generated Build call the validate method of the
+	// built entity when it has one.
+	Validate bool
+	// ValidateMethod is the name of the `func() error` method to call.
+	ValidateMethod string
+	// Options generates functional options for every struct, not only for
+	// those marked with the options directive.
+	Options bool
+	// Step generates step builders, which enforce required fields at compile
+	// time, instead of fluent builders for every struct.
+	Step bool
+	// Clone generates deep Clone methods for every struct.
+	Clone bool
+	// Equal generates Equal and Diff methods for every struct.
+	Equal bool
+	// Exported includes exported fields in the builders of every struct.
+	Exported bool
+	// Naming decides the generated identifiers, the idiomatic naming when nil.
+	Naming Naming
+	// OnConflict is what happens to a generated method whose name is already
+	// taken, CONFLICT_SKIP when empty or CONFLICT_ERROR.
+	OnConflict string
+}
+
+func (conf Config) naming() Naming {
+	if conf.Naming == nil {
+		return NewIdiomaticNaming()
+	}
+
+	return conf.Naming
+}
+
+func (conf Config) onConflict() string {
+	if conf.OnConflict == "" {
+		return CONFLICT_SKIP
+	}
+
+	return conf.OnConflict
+}
+
+func (conf Config) validateMethod() string {
+	if conf.ValidateMethod == "" {
+		return DEFAULT_VALIDATE_METHOD
+	}
+
+	return conf.ValidateMethod
+}
@@ -0,0 +1,263 @@
+package builder
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	CONFLICT_SKIP  = "skip"
+	CONFLICT_ERROR = "error"
+)
+
+// Notices receives the notices about decisions taken while generating, such
+// as skipped methods and renamed parameters. they go to stderr, apart from
+// the results printed on stdout.
+var Notices io.Writer = os.Stderr
+
+// reported remembers the notices already printed, since every generator
+// pass reaches the same decisions again.
+var reported = make(map[string]bool)
+
+func reportOnce(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if reported[message] {
+		return
+	}
+	reported[message] = true
+
+	fmt.Fprint(Notices, message)
+}
+
+// claim reserves name among the methods of owner, a type of the package, or
+// among the package level declarations when owner is "". when the name is
+// already taken by hand-written code or by code generated earlier in this
+// run, it reports false, or fails if the conflict policy says so or the
+// declaration cannot be left out.
+func (st PkgStruct) claim(owner string, name string, pos token.Pos, skippable bool) (bool, error) {
+	qualified := name
+	if owner != "" {
+		qualified = fmt.Sprintf("%s.%s", owner, name)
+	}
+
+	by := ""
+	switch {
+	case st.index.claims[qualified]:
+		by = "another generated declaration"
+	case st.index.declaredByHand(owner, name):
+		by = "a hand-written declaration"
+	default:
+		st.index.claims[qualified] = true
+		return true, nil
+	}
+
+	position := st.fset.Position(pos)
+	if !skippable || st.conf.onConflict() == CONFLICT_ERROR {
+		return false, fmt.Errorf("%s: %s collides with %s", position, qualified, by)
+	}
+	reportOnce("!!! %s: skip %s, which collides with %s\n", position, qualified, by)
+
+	return false, nil
+}
+
+// declaredByHand reports whether name is a method or field of owner, or a
+// package level declaration when owner is "", outside the generated files.
+func (idx *packageIndex) declaredByHand(owner string, name string) bool {
+	scope := idx.typesPkg.Scope()
+	if owner == "" {
+		obj := scope.Lookup(name)
+		return obj != nil && idx.isHandWritten(obj)
+	}
+
+	obj, ok := scope.Lookup(owner).(*types.TypeName)
+	if !ok {
+		return false
+	}
+	named, ok := obj.Type().(*types.Named)
+	if !ok {
+		return false
+	}
+
+	for i := 0; i < named.NumMethods(); i++ {
+		method := named.Method(i)
+		if method.Name() == name && idx.isHandWritten(method) {
+			return true
+		}
+	}
+
+	if meta, ok := named.Underlying().(*types.Struct); ok && idx.isHandWritten(obj) {
+		for i := 0; i < meta.NumFields(); i++ {
+			if meta.Field(i).Name() == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// reservedNames lists the identifiers that locals of the code generated for
+// named would shadow: its type parameters and the packages the code may refer
+// to, under their own name and under the one jennifer imports them as.
+func reservedNames(named *types.Named) map[string]bool {
+	reserved := make(map[string]bool)
+	for _, path := range []string{"maps", "reflect", "strings", "unsafe"} {
+		reserved[path] = true
+	}
+	for i := 0; i < named.TypeParams().Len(); i++ {
+		reserved[named.TypeParams().At(i).Obj().Name()] = true
+	}
+
+	reservePkg := func(pkg *types.Package) {
+		if pkg != nil {
+			reserved[pkg.Name()] = true
+			reserved[importAlias(pkg.Path())] = true
+		}
+	}
+
+	// clone and equal inline the fields of nested structs, so their types
+	// are walked as well, each named type once
+	visited := make(map[*types.TypeName]bool)
+	var walk func(t types.Type)
+	walk = func(t types.Type) {
+		switch t := t.(type) {
+		case *types.Named:
+			reservePkg(t.Obj().Pkg())
+			for i := 0; i < t.TypeArgs().Len(); i++ {
+				walk(t.TypeArgs().At(i))
+			}
+			if !visited[t.Obj()] {
+				visited[t.Obj()] = true
+				walk(t.Underlying())
+			}
+		case *types.Alias:
+			reservePkg(t.Obj().Pkg())
+			walk(types.Unalias(t))
+		case *types.Pointer:
+			walk(t.Elem())
+		case *types.Slice:
+			walk(t.Elem())
+		case *types.Array:
+			walk(t.Elem())
+		case *types.Map:
+			walk(t.Key())
+			walk(t.Elem())
+		case *types.Chan:
+			walk(t.Elem())
+		case *types.Signature:
+			walk(t.Params())
+			walk(t.Results())
+		case *types.Tuple:
+			for i := 0; i < t.Len(); i++ {
+				walk(t.At(i).Type())
+			}
+		case *types.Struct:
+			for i := 0; i < t.NumFields(); i++ {
+				walk(t.Field(i).Type())
+			}
+		case *types.Interface:
+			for i := 0; i < t.NumEmbeddeds(); i++ {
+				walk(t.EmbeddedType(i))
+			}
+			for i := 0; i < t.NumExplicitMethods(); i++ {
+				walk(t.ExplicitMethod(i).Type())
+			}
+		case *types.Union:
+			for i := 0; i < t.Len(); i++ {
+				walk(t.Term(i).Type())
+			}
+		}
+	}
+	walk(named.Underlying())
+
+	return reserved
+}
+
+// importAlias is the name jennifer imports path as when it does not know the
+// package name: the last element of the path, lower case and alphanumeric.
+func importAlias(path string) string {
+	path = strings.TrimSuffix(path, "/")
+	alias := strings.ToLower(path[strings.LastIndex(path, "/")+1:])
+	alias = strings.Map(func(r rune) rune {
+		if ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return -1
+	}, alias)
+
+	if alias = strings.TrimLeft(alias, "0123456789"); alias == "" {
+		return "pkg"
+	}
+
+	return alias
+}
+
+// local names a variable of the code generated for st, renaming it when it
+// would shadow a package or type parameter the code refers to.
+func (st PkgStruct) local(name string) string {
+	for st.reserved[name] {
+		name += "Value"
+	}
+
+	return name
+}
+
+// parameterName makes name usable as a parameter next to receiver, renaming
+// keywords, predeclared identifiers and the receiver name itself.
+func parameterName(name string, receiver string, pos token.Position) string {
+	switch {
+	case token.IsKeyword(name), types.Universe.Lookup(name) != nil:
+	case name == receiver:
+	default:
+		return name
+	}
+
+	renamed := name + "Value"
+	reportOnce("!!! %s: parameter %s is renamed to %s\n", pos, name, renamed)
+
+	return renamed
+}
+
+// claimBuilderNames reserves the declarations a builder cannot do without,
+// ahead of the optional methods, which give way to them.
+func (st PkgStruct) claimBuilderNames() error {
+	if len(st.builderFields()) <= 0 {
+		return nil
+	}
+
+	pos := st.named.Obj().Pos()
+	builder := st.builderName()
+	names := []string{st.builderInitializerName()}
+	if st.generatesStepBuilder() {
+		builder = st.stepBuilderName()
+		for _, field := range st.requiredFields() {
+			names = append(names, st.stepName(field))
+		}
+		names = append(names, st.optionalStepName())
+	} else if 0 < len(st.requiredFields()) {
+		names = append(names, st.missingFieldsErrorName())
+	}
+	names = append(names, builder)
+
+	for _, name := range names {
+		if _, err := st.claim("", name, pos, false); err != nil {
+			return err
+		}
+	}
+
+	methods := []string{"Build"}
+	if st.fallibleBuild() {
+		methods = append(methods, "MustBuild")
+	}
+	for _, method := range methods {
+		if _, err := st.claim(builder, method, pos, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
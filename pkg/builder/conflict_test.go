@@ -0,0 +1,57 @@
+package builder
+
+import (
+	"go/types"
+	"testing"
+)
+
+func TestImportAlias(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"fmt", "fmt"},
+		{"example.com/other", "other"},
+		{"example.com/go-yaml", "goyaml"},
+		{"example.com/Model/", "model"},
+		{"example.com/2fa", "fa"},
+		{"gopkg.in/yaml.v3", "yamlv3"},
+		{"example.com/2024", "pkg"},
+	}
+
+	for _, tt := range tests {
+		if got := importAlias(tt.path); got != tt.want {
+			t.Errorf("importAlias(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestLocal(t *testing.T) {
+	other := types.NewPackage("example.com/other", "other")
+	tag := types.NewNamed(types.NewTypeName(0, other, "Tag", nil), types.NewStruct(nil, nil), nil)
+
+	pkg := types.NewPackage("example.com/entity", "entity")
+	diff := types.NewTypeParam(types.NewTypeName(0, pkg, "diff", nil), types.NewInterfaceType(nil, nil))
+	fields := []*types.Var{
+		types.NewField(0, pkg, "tags", types.NewSlice(types.NewPointer(tag)), false),
+	}
+	named := types.NewNamed(types.NewTypeName(0, pkg, "Post", nil), types.NewStruct(fields, nil), nil)
+	named.SetTypeParams([]*types.TypeParam{diff})
+
+	st := PkgStruct{reserved: reservedNames(named)}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"other", "otherValue"},
+		{"diff", "diffValue"},
+		{"reflect", "reflectValue"},
+		{"cloned", "cloned"},
+	}
+
+	for _, tt := range tests {
+		if got := st.local(tt.name); got != tt.want {
+			t.Errorf("local(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
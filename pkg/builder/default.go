@@ -0,0 +1,133 @@
+package builder
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"math"
+	"sort"
+
+	. "github.com/dave/jennifer/jen"
+)
+
+const DEFAULT_TAG_VALUE = "default"
+
+// defaultValueCode type-checks the default expression of field in the scope
+// of the file declaring it and renders it, qualifying imported identifiers.
+func (st PkgStruct) defaultValueCode(field Field, expr string) (Code, error) {
+	position := st.fset.Position(field.Pos())
+
+	exprFset := token.NewFileSet()
+	node, err := parser.ParseExprFrom(exprFset, "", expr, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: default value %q of %s is not an expression: %v", position, expr, field.Name(), err)
+	}
+
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+	err = types.CheckExpr(exprFset, st.pkg, field.Pos(), node, info)
+	if err != nil {
+		return nil, fmt.Errorf("%s: default value %q of %s: %v", position, expr, field.Name(), err)
+	}
+
+	tv := info.Types[node]
+	if !types.AssignableTo(tv.Type, field.Type()) {
+		return nil, fmt.Errorf("%s: default value %q of %s: %s is not assignable to %s",
+			position, expr, field.Name(), tv.Type, field.Type())
+	}
+	if tv.Value != nil && !representable(tv.Value, field.Type()) {
+		return nil, fmt.Errorf("%s: default value %q of %s: %s overflows %s",
+			position, expr, field.Name(), tv.Value, field.Type())
+	}
+
+	return qualifiedExprCode(exprFset, node, expr, info), nil
+}
+
+// qualifiedExprCode re-emits expr verbatim except for references to imported
+// packages, which go through Qual so the generated file imports them.
+func qualifiedExprCode(fset *token.FileSet, node ast.Expr, expr string, info *types.Info) Code {
+	selectors := make([]*ast.SelectorExpr, 0)
+	ast.Inspect(node, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		ident, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		if _, ok := info.Uses[ident].(*types.PkgName); ok {
+			selectors = append(selectors, sel)
+		}
+		return true
+	})
+	sort.Slice(selectors, func(i, j int) bool {
+		return selectors[i].Pos() < selectors[j].Pos()
+	})
+
+	code := Null()
+	offset := 0
+	for _, sel := range selectors {
+		start := fset.Position(sel.Pos()).Offset
+		end := fset.Position(sel.End()).Offset
+		if offset < start {
+			code.Op(expr[offset:start])
+		}
+
+		pkgName := info.Uses[sel.X.(*ast.Ident)].(*types.PkgName)
+		code.Qual(pkgName.Imported().Path(), sel.Sel.Name)
+		offset = end
+	}
+	if offset < len(expr) {
+		code.Op(expr[offset:])
+	}
+
+	return code
+}
+
+func representable(value constant.Value, t types.Type) bool {
+	basic, ok := t.Underlying().(*types.Basic)
+	if !ok {
+		return true
+	}
+
+	switch {
+	case basic.Info()&types.IsInteger != 0:
+		value = constant.ToInt(value)
+		if value.Kind() != constant.Int {
+			return false
+		}
+		size := basicSize(basic)
+		if basic.Info()&types.IsUnsigned != 0 {
+			return constant.Sign(value) >= 0 && constant.BitLen(value) <= size
+		}
+		if constant.Sign(value) < 0 {
+			value = constant.UnaryOp(token.XOR, value, 0)
+		}
+		return constant.BitLen(value) < size
+	case basic.Kind() == types.Float32:
+		value = constant.ToFloat(value)
+		f, _ := constant.Float32Val(value)
+		return value.Kind() == constant.Float && !math.IsInf(float64(f), 0)
+	}
+
+	return true
+}
+
+func basicSize(basic *types.Basic) int {
+	switch basic.Kind() {
+	case types.Int8, types.Uint8:
+		return 8
+	case types.Int16, types.Uint16:
+		return 16
+	case types.Int32, types.Uint32:
+		return 32
+	}
+
+	return 64
+}
@@ -0,0 +1,42 @@
+package builder
+
+import (
+	"go/ast"
+	"strings"
+)
+
+const (
+	DIRECTIVE_PREFIX = "//builder:"
+
+	VALIDATE_DIRECTIVE = "validate"
+)
+
+// Directives holds the `//builder:name value` comments attached to a type
+// declaration.
+type Directives map[string]string
+
+func parseDirectives(groups ...*ast.CommentGroup) Directives {
+	directives := make(Directives)
+	for _, group := range groups {
+		if group == nil {
+			continue
+		}
+
+		for _, comment := range group.List {
+			if !strings.HasPrefix(comment.Text, DIRECTIVE_PREFIX) {
+				continue
+			}
+
+			directive := strings.TrimPrefix(comment.Text, DIRECTIVE_PREFIX)
+			name, value, _ := strings.Cut(directive, " ")
+			directives[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+
+	return directives
+}
+
+func (directives Directives) Lookup(name string) (value string, found bool) {
+	value, found = directives[name]
+	return
+}
@@ -0,0 +1,77 @@
+package builder
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+)
+
+// flattenEmbedded lists the fields promoted from the embedded struct field, so
+// that the builder sets each of them on its own and Build composes the
+// embedded value. only fields accessible from pkg are promoted: the private
+// ones of a struct in the same package, along with the exported ones when
+// exported is set, and the exported ones of a struct in another package.
+func flattenEmbedded(fset *token.FileSet, pkg *types.Package, outer *types.Struct, embedded *types.Var, opened []Field, exported bool, naming Naming) ([]Field, error) {
+	position := fset.Position(embedded.Pos())
+	if !embedded.Embedded() {
+		return nil, fmt.Errorf("%s: invalid tag of %s: %q applies only to embedded fields",
+			position, embedded.Name(), FLATTEN_OPTION)
+	}
+	if _, ok := embedded.Type().(*types.Pointer); ok {
+		return nil, fmt.Errorf("%s: invalid tag of %s: %q needs an embedded struct, not a pointer to one",
+			position, embedded.Name(), FLATTEN_OPTION)
+	}
+	inner, ok := embedded.Type().Underlying().(*types.Struct)
+	if !ok {
+		return nil, fmt.Errorf("%s: invalid tag of %s: %q applies only to embedded structs",
+			position, embedded.Name(), FLATTEN_OPTION)
+	}
+
+	// promotion only works for names no other field claims
+	taken := make(map[string]bool)
+	for i := 0; i < outer.NumFields(); i++ {
+		taken[outer.Field(i).Name()] = true
+	}
+	for _, field := range opened {
+		taken[field.Name()] = true
+	}
+
+	fields := make([]Field, 0, inner.NumFields())
+	for i := 0; i < inner.NumFields(); i++ {
+		field := inner.Field(i)
+		if field.Name() == "_" {
+			continue
+		}
+		if field.Pkg() == pkg && field.Exported() && !exported {
+			continue
+		}
+		if field.Pkg() != pkg && !field.Exported() {
+			continue
+		}
+
+		opts, err := parseFieldOptions(inner.Tag(i))
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid tag of %s: %v", fset.Position(field.Pos()), field.Name(), err)
+		}
+		switch {
+		case opts.Flatten:
+			return nil, fmt.Errorf("%s: invalid tag of %s: %q cannot be nested in %s",
+				fset.Position(field.Pos()), field.Name(), FLATTEN_OPTION, embedded.Name())
+		case opts.HasDefault && field.Pkg() != pkg:
+			return nil, fmt.Errorf("%s: default of %s cannot be evaluated when flattened into package %s",
+				fset.Position(field.Pos()), field.Name(), pkg.Name())
+		case taken[field.Name()]:
+			return nil, fmt.Errorf("%s: %s promoted from %s collides with another field of the same name",
+				position, field.Name(), embedded.Name())
+		}
+		taken[field.Name()] = true
+
+		fields = append(fields, Field{tag: inner.Tag(i), opts: opts, Var: field, embedded: embedded, naming: naming})
+	}
+
+	if len(fields) <= 0 {
+		return nil, fmt.Errorf("%s: %s has no fields to flatten", position, embedded.Name())
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,323 @@
+package builder
+
+import (
+	"fmt"
+	"go/types"
+	"reflect"
+
+	. "github.com/dave/jennifer/jen"
+)
+
+const (
+	EQUAL_TAG_VALUE = "eq"
+	EQUAL_DIRECTIVE = "equal"
+
+	EQUAL_SKIP = "-"
+)
+
+func (st PkgStruct) generatesEqual() bool {
+	return generatesEqual(st.conf, st.directives)
+}
+
+func generatesEqual(conf Config, directives Directives) bool {
+	if conf.Equal {
+		return true
+	}
+
+	_, found := directives.Lookup(EQUAL_DIRECTIVE)
+	return found
+}
+
+// DefineEqual emits Equal and Diff methods comparing two entities field by
+// field, recursing into slices, maps, pointers and types with their own Equal.
+// `eq:"-"` leaves a field out of both.
+func (st PkgStruct) DefineEqual(file *File) error {
+	if !st.generatesEqual() {
+		return nil
+	}
+
+	fields, err := st.comparedFields()
+	if err != nil {
+		return err
+	}
+	generatesEqual, err := st.claim(st.name, "Equal", st.named.Obj().Pos(), true)
+	if err != nil {
+		return err
+	}
+	generatesDiff, err := st.claim(st.name, "Diff", st.named.Obj().Pos(), true)
+	if err != nil {
+		return err
+	}
+
+	receiver := st.entityReceiverName()
+	other := distinctName(st.local("other"), receiver)
+	diff := distinctName(st.local("diff"), receiver)
+
+	equalBody := []Code{
+		If(Id(receiver).Op("==").Nil().Op("||").Id(other).Op("==").Nil()).Block(
+			Return(Id(receiver).Op("==").Id(other)),
+		),
+		Line(),
+	}
+	diffBody := []Code{
+		If(Id(receiver).Op("==").Nil().Op("||").Id(other).Op("==").Nil()).Block(
+			If(Id(receiver).Op("==").Id(other)).Block(Return(Nil())),
+			Return(Index().String().ValuesFunc(func(g *Group) {
+				for _, field := range fields {
+					g.Lit(field.Name())
+				}
+			})),
+		),
+		Line(),
+		Var().Id(diff).Index().String(),
+	}
+	for _, field := range fields {
+		differs := st.newComparer().differs(Id(receiver).Dot(field.Name()), Id(other).Dot(field.Name()), field.Type())
+		equalBody = append(equalBody, If(differs).Block(Return(False())))
+		diffBody = append(diffBody, If(differs).Block(
+			Id(diff).Op("=").Append(Id(diff), Lit(field.Name())),
+		))
+	}
+	equalBody = append(equalBody, Line(), Return(True()))
+	diffBody = append(diffBody, Line(), Return(Id(diff)))
+
+	entityType := Op("*").Id(st.name).Types(st.typeArgs()...)
+	if generatesEqual {
+		file.Func().Params(Id(receiver).Add(entityType.Clone())).
+			Id("Equal").
+			Params(Id(other).Add(entityType.Clone())).
+			Bool().
+			Block(equalBody...).
+			Line()
+	}
+
+	if generatesDiff {
+		file.Func().Params(Id(receiver).Add(entityType.Clone())).
+			Id("Diff").
+			Params(Id(other).Add(entityType.Clone())).
+			Index().String().
+			Block(diffBody...).
+			Line()
+	}
+
+	return nil
+}
+
+func (st PkgStruct) comparedFields() ([]*types.Var, error) {
+	fields := make([]*types.Var, 0, st.meta.NumFields())
+	for i := 0; i < st.meta.NumFields(); i++ {
+		field := st.meta.Field(i)
+		if field.Name() == "_" {
+			continue
+		}
+
+		mode, _ := reflect.StructTag(st.meta.Tag(i)).Lookup(EQUAL_TAG_VALUE)
+		switch mode {
+		case "":
+			fields = append(fields, field)
+		case EQUAL_SKIP:
+			continue
+		default:
+			return nil, fmt.Errorf("%s: invalid %s tag of %s: %q, expected %q",
+				st.fset.Position(field.Pos()), EQUAL_TAG_VALUE, field.Name(), mode, EQUAL_SKIP)
+		}
+	}
+
+	return fields, nil
+}
+
+type comparer struct {
+	st PkgStruct
+	// visiting guards against self-referential types being expanded forever
+	visiting map[*types.TypeName]bool
+}
+
+func (st PkgStruct) newComparer() *comparer {
+	return &comparer{
+		st:       st,
+		visiting: map[*types.TypeName]bool{},
+	}
+}
+
+// differs renders a condition which holds when a and b are not equal.
+func (cmp *comparer) differs(a, b Code, t types.Type) Code {
+	if !cmp.needsDeepEqual(t) {
+		return Add(a).Op("!=").Add(b)
+	}
+
+	return Op("!").Add(cmp.equalExpr(a, b, t))
+}
+
+// id refers to the local name of closures in the comparison code.
+func (cmp *comparer) id(name string) *Statement {
+	return Id(cmp.st.local(name))
+}
+
+// needsDeepEqual reports whether values of t cannot be compared with ==.
+func (cmp *comparer) needsDeepEqual(t types.Type) bool {
+	if named, ok := t.(*types.Named); ok {
+		if _, found := cmp.equalMethod(named); found {
+			return true
+		}
+		if cmp.visiting[named.Obj()] || !inlinable(cmp.st.pkg, named) {
+			return !types.Comparable(t)
+		}
+
+		cmp.visiting[named.Obj()] = true
+		defer delete(cmp.visiting, named.Obj())
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Pointer, *types.Slice, *types.Map, *types.Signature:
+		return true
+	case *types.Interface:
+		// an interface holding an incomparable value panics on ==
+		_, isTypeParam := t.(*types.TypeParam)
+		return !isTypeParam || !types.Comparable(t)
+	case *types.Array:
+		return cmp.needsDeepEqual(u.Elem())
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			if cmp.needsDeepEqual(u.Field(i).Type()) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// equalExpr renders a boolean expression comparing a and b. Both must be
+// addressable, so that Equal methods taking a pointer can be called.
+func (cmp *comparer) equalExpr(a, b Code, t types.Type) Code {
+	if !cmp.needsDeepEqual(t) {
+		return Add(a).Op("==").Add(b)
+	}
+
+	if named, ok := t.(*types.Named); ok {
+		if byPointer, found := cmp.equalMethod(named); found {
+			if byPointer {
+				return Add(a).Dot("Equal").Call(Op("&").Add(b))
+			}
+			return Add(a).Dot("Equal").Call(b)
+		}
+		if cmp.visiting[named.Obj()] || !inlinable(cmp.st.pkg, named) {
+			return Qual("reflect", "DeepEqual").Call(a, b)
+		}
+
+		cmp.visiting[named.Obj()] = true
+		defer delete(cmp.visiting, named.Obj())
+	}
+
+	typ := typeCode(t)
+	switch u := t.Underlying().(type) {
+	case *types.Pointer:
+		return cmp.equalPointer(a, b, typ, u)
+	case *types.Slice:
+		return Func().Params(List(cmp.id("a"), cmp.id("b")).Add(typ)).Bool().Block(
+			If(Len(cmp.id("a")).Op("!=").Len(cmp.id("b"))).Block(Return(False())),
+			For(cmp.id("i").Op(":=").Range().Add(cmp.id("a"))).Block(
+				If(cmp.differs(cmp.id("a").Index(cmp.id("i")), cmp.id("b").Index(cmp.id("i")), u.Elem())).Block(Return(False())),
+			),
+			Return(True()),
+		).Call(a, b)
+	case *types.Map:
+		return Func().Params(List(cmp.id("a"), cmp.id("b")).Add(typ)).Bool().Block(
+			If(Len(cmp.id("a")).Op("!=").Len(cmp.id("b"))).Block(Return(False())),
+			For(List(cmp.id("k"), cmp.id("v")).Op(":=").Range().Add(cmp.id("a"))).Block(
+				List(cmp.id("w"), cmp.id("ok")).Op(":=").Add(cmp.id("b")).Index(cmp.id("k")),
+				If(Op("!").Add(cmp.id("ok")).Op("||").Add(cmp.differs(cmp.id("v"), cmp.id("w"), u.Elem()))).Block(Return(False())),
+			),
+			Return(True()),
+		).Call(a, b)
+	case *types.Array:
+		return Func().Params(List(cmp.id("a"), cmp.id("b")).Add(typ)).Bool().Block(
+			For(cmp.id("i").Op(":=").Range().Add(cmp.id("a"))).Block(
+				If(cmp.differs(cmp.id("a").Index(cmp.id("i")), cmp.id("b").Index(cmp.id("i")), u.Elem())).Block(Return(False())),
+			),
+			Return(True()),
+		).Call(a, b)
+	case *types.Struct:
+		body := make([]Code, 0, u.NumFields()+1)
+		for i := 0; i < u.NumFields(); i++ {
+			field := u.Field(i)
+			if field.Name() == "_" {
+				continue
+			}
+			body = append(body, If(
+				cmp.differs(cmp.id("a").Dot(field.Name()), cmp.id("b").Dot(field.Name()), field.Type()),
+			).Block(Return(False())))
+		}
+		body = append(body, Return(True()))
+		return Func().Params(List(cmp.id("a"), cmp.id("b")).Add(typ)).Bool().Block(body...).Call(a, b)
+	case *types.Signature:
+		// functions only compare to nil
+		return Parens(Parens(Add(a).Op("==").Nil()).Op("==").Parens(Add(b).Op("==").Nil()))
+	}
+
+	return Qual("reflect", "DeepEqual").Call(a, b)
+}
+
+func (cmp *comparer) equalPointer(a, b Code, typ Code, t *types.Pointer) Code {
+	elem := t.Elem()
+	body := []Code{
+		If(cmp.id("a").Op("==").Nil().Op("||").Add(cmp.id("b")).Op("==").Nil()).Block(
+			Return(cmp.id("a").Op("==").Add(cmp.id("b"))),
+		),
+	}
+
+	named, isNamed := elem.(*types.Named)
+	byPointer, found := false, false
+	if isNamed {
+		byPointer, found = cmp.equalMethod(named)
+	}
+
+	switch {
+	case found && byPointer:
+		body = append(body, Return(cmp.id("a").Dot("Equal").Call(cmp.id("b"))))
+	case found:
+		body = append(body, Return(cmp.id("a").Dot("Equal").Call(Op("*").Add(cmp.id("b")))))
+	default:
+		body = append(body, Return(cmp.equalExpr(Op("*").Add(cmp.id("a")), Op("*").Add(cmp.id("b")), elem)))
+	}
+
+	return Func().Params(List(cmp.id("a"), cmp.id("b")).Add(typ)).Bool().Block(body...).Call(a, b)
+}
+
+// equalMethod finds an `Equal(T) bool` or `Equal(*T) bool` method of t,
+// either generated in this run or hand-written.
+func (cmp *comparer) equalMethod(t *types.Named) (byPointer bool, found bool) {
+	obj := t.Obj()
+	if obj.Pkg() == cmp.st.pkg && cmp.st.index.declares(obj) {
+		if _, ok := t.Underlying().(*types.Struct); ok && generatesEqual(cmp.st.conf, cmp.st.index.directivesOf(obj)) {
+			return true, true
+		}
+	}
+
+	method, _, _ := types.LookupFieldOrMethod(types.NewPointer(t), false, obj.Pkg(), "Equal")
+	fn, ok := method.(*types.Func)
+	if !ok {
+		return false, false
+	}
+	if fn.Pkg() == cmp.st.pkg && !cmp.st.index.isHandWritten(fn) {
+		return false, false
+	}
+
+	sig := fn.Type().(*types.Signature)
+	if sig.Params().Len() != 1 || sig.Results().Len() != 1 {
+		return false, false
+	}
+	if !types.Identical(sig.Results().At(0).Type(), types.Typ[types.Bool]) {
+		return false, false
+	}
+
+	param := sig.Params().At(0).Type()
+	switch {
+	case types.Identical(param, t):
+		return false, true
+	case types.Identical(param, types.NewPointer(t)):
+		return true, true
+	}
+
+	return false, false
+}
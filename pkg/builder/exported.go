@@ -0,0 +1,28 @@
+package builder
+
+const EXPORTED_DIRECTIVE = "exported"
+
+// includesExported reports whether exported fields get builder state too. they
+// are settable directly, so they never get accessors.
+func includesExported(conf Config, directives Directives) bool {
+	if conf.Exported {
+		return true
+	}
+
+	_, found := directives.Lookup(EXPORTED_DIRECTIVE)
+	return found
+}
+
+// accessorFields is filterOpenedFields without the exported fields, which
+// need no accessors.
+func (st PkgStruct) accessorFields() (fields []Field) {
+	for _, field := range st.filterOpenedFields() {
+		if field.Exported() && !field.Embedded() {
+			continue
+		}
+
+		fields = append(fields, field)
+	}
+
+	return
+}
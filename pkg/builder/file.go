@@ -1,6 +1,7 @@
 package builder
 
 import (
+	"bytes"
 	"go/ast"
 	"go/token"
 	"go/types"
@@ -14,35 +15,128 @@ type PkgFile struct {
 	gendecls []*ast.GenDecl
 	FileName string
 	PkgName  string
+	PkgPath  string
 	pkgScope *types.Scope
+	typesPkg *types.Package
+	conf     Config
+	index    *packageIndex
 }
 
-func (file PkgFile) GenerateBuilder() string {
-	f := NewFile(file.PkgName)
+func (file PkgFile) GenerateBuilder() (string, error) {
+	f := NewFilePathName(file.PkgPath, file.PkgName)
+	f.HeaderComment(file.header())
 
-	structs := file.parsePkgStructs()
+	structs, err := file.parsePkgStructs()
+	if err != nil {
+		return "", err
+	}
 	for _, st := range structs {
+		if err := st.claimBuilderNames(); err != nil {
+			return "", err
+		}
+	}
+	for _, st := range structs {
+		if st.generatesStepBuilder() {
+			if err := st.DefineStepBuilder(f); err != nil {
+				return "", err
+			}
+			if err := st.DefineToBuilder(f); err != nil {
+				return "", err
+			}
+			continue
+		}
+
 		st.DefineBuilderStruct(f)
-		st.DefineBuilderInitializer(f)
-		st.DefineBuilderConstructors(f)
+		if err := st.DefineBuilderInitializer(f); err != nil {
+			return "", err
+		}
+		if err := st.DefineBuilderConstructors(f); err != nil {
+			return "", err
+		}
 		st.DefineBuildFunc(f)
+		if err := st.DefineToBuilder(f); err != nil {
+			return "", err
+		}
+		st.DefineMissingFieldsError(f)
 	}
 
-	return f.GoString()
+	return render(f)
 }
 
-func (file PkgFile) GenerateAccessor() string {
-	f := NewFile(file.PkgName)
+func (file PkgFile) GenerateAccessor() (string, error) {
+	f := NewFilePathName(file.PkgPath, file.PkgName)
+	f.HeaderComment(file.header())
 
-	structs := file.parsePkgStructs()
+	structs, err := file.parsePkgStructs()
+	if err != nil {
+		return "", err
+	}
 	for _, st := range structs {
-		st.DefineAccessors(f)
+		if err := st.DefineAccessors(f); err != nil {
+			return "", err
+		}
+		if err := st.DefineClone(f); err != nil {
+			return "", err
+		}
+		if err := st.DefineEqual(f); err != nil {
+			return "", err
+		}
+	}
+
+	return render(f)
+}
+
+func (file PkgFile) GenerateOptions() (string, error) {
+	f := NewFilePathName(file.PkgPath, file.PkgName)
+	f.HeaderComment(file.header())
+
+	generates := false
+	structs, err := file.parsePkgStructs()
+	if err != nil {
+		return "", err
+	}
+	for _, st := range structs {
+		if !st.generatesOptions() {
+			continue
+		}
+		generates = true
+
+		if err := st.DefineOptions(f); err != nil {
+			return "", err
+		}
+	}
+	if !generates {
+		return "", nil
+	}
+
+	return render(f)
+}
+
+// StructNames lists the structs of the file that code is generated for.
+func (file PkgFile) StructNames() ([]string, error) {
+	structs, err := file.parsePkgStructs()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(structs))
+	for _, st := range structs {
+		names = append(names, st.name)
+	}
+
+	return names, nil
+}
+
+func render(f *File) (string, error) {
+	buf := &bytes.Buffer{}
+	if err := f.Render(buf); err != nil {
+		return "", err
 	}
 
-	return f.GoString()
+	return buf.String(), nil
 }
 
-func (file PkgFile) parsePkgStructs() (pkgStructs []PkgStruct) {
+func (file PkgFile) parsePkgStructs() (pkgStructs []PkgStruct, err error) {
 	for _, decl := range file.gendecls {
 		for _, spec := range decl.Specs {
 			typeSpec, ok := spec.(*ast.TypeSpec)
@@ -50,16 +144,30 @@ func (file PkgFile) parsePkgStructs() (pkgStructs []PkgStruct) {
 				continue
 			}
 
+			if typeSpec.Assign.IsValid() {
+				continue
+			}
+
 			st := file.pkgScope.Lookup(typeSpec.Name.Name)
-			sturctMeta, ok := st.Type().Underlying().(*types.Struct)
+			if st == nil {
+				continue
+			}
+
+			named, ok := st.Type().(*types.Named)
 			if !ok {
 				continue
 			}
 
-			pkgStruct := PkgStruct{
-				fset: file.fset,
-				name: typeSpec.Name.Name,
-				meta: sturctMeta,
+			if _, ok := named.Underlying().(*types.Struct); !ok {
+				continue
+			}
+
+			directives := parseDirectives(decl.Doc, typeSpec.Doc)
+			file.warnMissingValidateMethod(named, directives)
+
+			pkgStruct, err := newPkgStruct(file.index, named, directives, file.conf)
+			if err != nil {
+				return nil, err
 			}
 			pkgStructs = append(pkgStructs, pkgStruct)
 		}
@@ -67,3 +175,74 @@ func (file PkgFile) parsePkgStructs() (pkgStructs []PkgStruct) {
 
 	return
 }
+
+func newPkgStruct(index *packageIndex, named *types.Named, directives Directives, conf Config) (PkgStruct, error) {
+	sturctMeta := named.Underlying().(*types.Struct)
+	fields, err := parseOpenedFields(index.fset, index.typesPkg, sturctMeta, includesExported(conf, directives), conf.naming())
+	if err != nil {
+		return PkgStruct{}, err
+	}
+
+	return PkgStruct{
+		fset:       index.fset,
+		pkg:        index.typesPkg,
+		name:       named.Obj().Name(),
+		meta:       sturctMeta,
+		typeParams: named.TypeParams(),
+		directives: directives,
+		validate:   validateMethod(conf, named, directives),
+		conf:       conf,
+		index:      index,
+		named:      named,
+		fields:     fields,
+		reserved:   reservedNames(named),
+	}, nil
+}
+
+func validateMethod(conf Config, named *types.Named, directives Directives) string {
+	method := conf.validateMethod()
+	value, found := directives.Lookup(VALIDATE_DIRECTIVE)
+	if !found && !conf.Validate {
+		return ""
+	}
+	if value != "" {
+		method = value
+	}
+
+	if !hasValidateMethod(named, method) {
+		return ""
+	}
+
+	return method
+}
+
+func (file PkgFile) warnMissingValidateMethod(named *types.Named, directives Directives) {
+	value, found := directives.Lookup(VALIDATE_DIRECTIVE)
+	if !found {
+		return
+	}
+
+	method := file.conf.validateMethod()
+	if value != "" {
+		method = value
+	}
+	if !hasValidateMethod(named, method) {
+		reportOnce("!!! %s: %s has no method %s() error, skip validation\n",
+			file.fset.Position(named.Obj().Pos()), named.Obj().Name(), method)
+	}
+}
+
+func hasValidateMethod(named *types.Named, method string) bool {
+	obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(named), true, named.Obj().Pkg(), method)
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return false
+	}
+
+	sig := fn.Type().(*types.Signature)
+	if sig.Params().Len() != 0 || sig.Results().Len() != 1 {
+		return false
+	}
+
+	return types.Identical(sig.Results().At(0).Type(), types.Universe.Lookup("error").Type())
+}
@@ -0,0 +1,81 @@
+package builder
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"strings"
+)
+
+const MODULE_PATH = "github.com/arabian9ts/builder"
+
+// generatedHeader matches the first line of generated files, following the
+// convention of https://go.dev/s/generatedcode, and captures the source file.
+var generatedHeader = regexp.MustCompile(`^// Code generated by builder \S+ from (.+)\. DO NOT EDIT\.$`)
+
+// headerVersion matches the version within the header.
+var headerVersion = regexp.MustCompile(`^(// Code generated by builder )\S+( from .+\. DO NOT EDIT\.)$`)
+
+// Version is the version of builder recorded in generated files, taken from
+// the build info of the binary.
+func Version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(devel)"
+	}
+	if info.Main.Path == MODULE_PATH && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == MODULE_PATH {
+			return dep.Version
+		}
+	}
+
+	return "(devel)"
+}
+
+// header is the comment marking the files generated from the file.
+func (file PkgFile) header() string {
+	return fmt.Sprintf("Code generated by builder %s from %s. DO NOT EDIT.", Version(), filepath.Base(file.FileName))
+}
+
+// SameGenerated reports whether the generated codes a and b are the same but
+// for the builder version in their header, since builds from different
+// commits get different versions, while generating the same code.
+func SameGenerated(a string, b string) bool {
+	return withoutVersion(a) == withoutVersion(b)
+}
+
+func withoutVersion(code string) string {
+	header, rest, _ := strings.Cut(code, "\n")
+	return headerVersion.ReplaceAllString(header, "${1}${2}") + "\n" + rest
+}
+
+// GeneratedFrom reads the header of fileName and returns the path of the
+// source file it was generated from. files without the header of builder are
+// not generated, whatever their name.
+func GeneratedFrom(fileName string) (string, bool, error) {
+	fp, err := os.Open(fileName)
+	if err != nil {
+		return "", false, err
+	}
+	defer fp.Close()
+
+	// the header has to precede the package clause
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if matched := generatedHeader.FindStringSubmatch(line); matched != nil {
+			return filepath.Join(filepath.Dir(fileName), matched[1]), true, nil
+		}
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+	}
+
+	return "", false, scanner.Err()
+}
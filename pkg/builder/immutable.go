@@ -0,0 +1,98 @@
+package builder
+
+import (
+	"fmt"
+
+	. "github.com/dave/jennifer/jen"
+)
+
+const IMMUTABLE_DIRECTIVE = "immutable"
+
+// immutable reports whether the struct is a value object, either marked as a
+// whole by the immutable directive or by a `with` tag on any of its fields.
+func (st PkgStruct) immutable() bool {
+	if _, found := st.directives.Lookup(IMMUTABLE_DIRECTIVE); found {
+		return true
+	}
+
+	for _, field := range st.accessorFields() {
+		if _, found := field.WitherTagValue(); found {
+			return true
+		}
+	}
+
+	return false
+}
+
+// defineImmutableAccessors emits value receiver getters and WithXxx methods
+// returning a modified copy. value objects never get setters.
+func (st PkgStruct) defineImmutableAccessors(file *File) error {
+	for _, field := range st.accessorFields() {
+		if _, found := field.SetterTagValue(); found {
+			return fmt.Errorf("%s: %s is immutable, but %s has a %q tag",
+				st.fset.Position(field.Pos()), st.name, field.Name(), SETTER_TAG_VALUE)
+		}
+	}
+
+	_, allFields := st.directives.Lookup(IMMUTABLE_DIRECTIVE)
+	receiver := st.entityReceiverName()
+	receiverType := Id(st.name).Types(st.typeArgs()...)
+
+	// getter
+	for _, field := range st.accessorFields() {
+		getter, found := field.GetterTagValue()
+		if !found {
+			continue
+		}
+		if getter == "" {
+			getter = st.conf.naming().Getter(field.Name())
+		}
+		ok, err := st.claim(st.name, getter, field.Pos(), true)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		file.Func().Params(Id(receiver).Add(receiverType.Clone())).
+			Id(getter).
+			Params().
+			Params(typeCode(field.Type())).
+			Block(
+				Return(Id(receiver).Op(".").Id(field.Name())),
+			).
+			Line()
+	}
+
+	// wither
+	for _, field := range st.accessorFields() {
+		wither, found := field.WitherTagValue()
+		if wither == "-" || (!found && !allFields) {
+			continue
+		}
+		if wither == "" {
+			wither = st.conf.naming().Wither(field.Name())
+		}
+		ok, err := st.claim(st.name, wither, field.Pos(), true)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		argument := st.argumentName(field, receiver)
+		file.Func().Params(Id(receiver).Add(receiverType.Clone())).
+			Id(wither).
+			Params(Id(argument).Add(typeCode(field.Type()))).
+			Params(receiverType.Clone()).
+			Block(
+				Id(receiver).Op(".").Id(field.Name()).Op("=").Id(argument),
+				Return(Id(receiver)),
+			).
+			Line()
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package builder
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// packageIndex records what the whole package declares, for emitters that
+// need to know about structs and methods outside the file being generated.
+type packageIndex struct {
+	fset          *token.FileSet
+	typesPkg      *types.Package
+	excludedFiles map[string]bool
+	directives    map[*types.TypeName]Directives
+	siblings      map[string]*Package
+	// claims holds the names taken by generated declarations so far
+	claims map[string]bool
+}
+
+func newPackageIndex(pkg *Package) *packageIndex {
+	idx := &packageIndex{
+		fset:          pkg.fset,
+		typesPkg:      pkg.typesPkg,
+		excludedFiles: pkg.excludedFiles,
+		directives:    make(map[*types.TypeName]Directives),
+		siblings:      pkg.siblings,
+		claims:        make(map[string]bool),
+	}
+
+	for _, f := range pkg.astFiles {
+		for _, decl := range f.Decls {
+			gendecl, ok := decl.(*ast.GenDecl)
+			if !ok {
+				continue
+			}
+
+			for _, spec := range gendecl.Specs {
+				typeSpec, ok := spec.(*ast.TypeSpec)
+				if !ok {
+					continue
+				}
+
+				obj, ok := pkg.typesPkg.Scope().Lookup(typeSpec.Name.Name).(*types.TypeName)
+				if !ok {
+					continue
+				}
+				idx.directives[obj] = parseDirectives(gendecl.Doc, typeSpec.Doc)
+			}
+		}
+	}
+
+	return idx
+}
+
+// declares reports whether obj is declared in one of the input files, i.e.
+// whether builder generates code for it in this run.
+func (idx *packageIndex) declares(obj *types.TypeName) bool {
+	_, found := idx.directives[obj]
+	return found
+}
+
+func (idx *packageIndex) directivesOf(obj *types.TypeName) Directives {
+	return idx.directives[obj]
+}
+
+// isHandWritten reports whether obj is declared outside the files builder
+// generated, so that previous output is not mistaken for user code.
+func (idx *packageIndex) isHandWritten(obj types.Object) bool {
+	if !obj.Pos().IsValid() {
+		return true
+	}
+
+	return !idx.excludedFiles[idx.fset.Position(obj.Pos()).Filename]
+}
+
+// handWrittenReceiver finds the receiver name used by the hand-written
+// methods of t, the first one in source order.
+func (idx *packageIndex) handWrittenReceiver(t *types.Named) (string, bool) {
+	receiver, pos := "", token.NoPos
+	for i := 0; i < t.NumMethods(); i++ {
+		method := t.Method(i)
+		if !idx.isHandWritten(method) || (pos.IsValid() && pos < method.Pos()) {
+			continue
+		}
+
+		recv := method.Type().(*types.Signature).Recv()
+		if recv == nil || recv.Name() == "" || recv.Name() == "_" {
+			continue
+		}
+		receiver, pos = recv.Name(), method.Pos()
+	}
+
+	return receiver, receiver != ""
+}
+
+// lookupStruct describes a struct declared in this package or in one loaded
+// along with it, as it would be when generating code for its own package.
+func (idx *packageIndex) lookupStruct(named *types.Named, conf Config) (PkgStruct, bool) {
+	owner := idx
+	if pkg := named.Obj().Pkg(); pkg != idx.typesPkg {
+		if pkg == nil {
+			return PkgStruct{}, false
+		}
+		sibling, found := idx.siblings[pkg.Path()]
+		if !found {
+			return PkgStruct{}, false
+		}
+		owner = sibling.packageIndex()
+	}
+
+	obj, ok := owner.typesPkg.Scope().Lookup(named.Obj().Name()).(*types.TypeName)
+	if !ok || !owner.declares(obj) {
+		return PkgStruct{}, false
+	}
+	ownNamed, ok := obj.Type().(*types.Named)
+	if !ok {
+		return PkgStruct{}, false
+	}
+	if _, ok := ownNamed.Underlying().(*types.Struct); !ok {
+		return PkgStruct{}, false
+	}
+
+	st, err := newPkgStruct(owner, ownNamed, owner.directivesOf(obj), conf)
+	if err != nil {
+		return PkgStruct{}, false
+	}
+
+	return st, true
+}
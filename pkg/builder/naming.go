@@ -0,0 +1,195 @@
+package builder
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	IDIOMATIC_NAMING = "idiomatic"
+	LEGACY_NAMING    = "legacy"
+)
+
+// DEFAULT_INITIALISMS are kept in a single case by the idiomatic naming, as
+// Go style asks for ID and URL rather than Id and Url.
+var DEFAULT_INITIALISMS = []string{
+	"ACL", "API", "ASCII", "CPU", "CSS", "DNS", "EOF", "GUID", "HTML", "HTTP",
+	"HTTPS", "ID", "IP", "JSON", "LHS", "QPS", "RAM", "RHS", "RPC", "SLA",
+	"SMTP", "SQL", "SSH", "TCP", "TLS", "TTL", "UDP", "UI", "UID", "UUID",
+	"URI", "URL", "UTF8", "VM", "XML", "XMPP", "XSRF", "XSS",
+}
+
+// Naming decides the identifiers of generated methods, receivers and
+// parameters.
+type Naming interface {
+	// Exported turns a field name into the exported form used in method names.
+	Exported(name string) string
+	// Unexported turns a field name into the form used for parameters.
+	Unexported(name string) string
+	Getter(field string) string
+	Setter(field string) string
+	Wither(field string) string
+	// Receiver names the receiver of methods on the entity typeName.
+	Receiver(typeName string) string
+	// BuilderReceiver names the receiver of methods on the builder of typeName.
+	BuilderReceiver(typeName string) string
+}
+
+// NamingStrategy returns the naming registered as name. initialisms extend
+// DEFAULT_INITIALISMS and are ignored by the legacy naming.
+func NamingStrategy(name string, initialisms []string) (Naming, error) {
+	switch name {
+	case "", IDIOMATIC_NAMING:
+		return NewIdiomaticNaming(initialisms...), nil
+	case LEGACY_NAMING:
+		return legacyNaming{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown naming %q, expected %q or %q", name, IDIOMATIC_NAMING, LEGACY_NAMING)
+}
+
+// idiomaticNaming follows Go style: getters without Get, initialisms in a
+// single case and short receivers.
+type idiomaticNaming struct {
+	initialisms map[string]bool
+}
+
+func NewIdiomaticNaming(initialisms ...string) Naming {
+	naming := idiomaticNaming{initialisms: make(map[string]bool)}
+	for _, initialism := range append(DEFAULT_INITIALISMS, initialisms...) {
+		naming.initialisms[strings.ToUpper(strings.TrimSpace(initialism))] = true
+	}
+
+	return naming
+}
+
+func (naming idiomaticNaming) Exported(name string) string {
+	words := splitWords(name)
+	for i, word := range words {
+		words[i] = naming.capitalize(word)
+	}
+
+	return strings.Join(words, "")
+}
+
+func (naming idiomaticNaming) Unexported(name string) string {
+	words := splitWords(name)
+	for i, word := range words {
+		if i == 0 {
+			words[i] = lowerFirst(word)
+			if naming.initialisms[strings.ToUpper(word)] {
+				words[i] = strings.ToLower(word)
+			}
+			continue
+		}
+		words[i] = naming.capitalize(word)
+	}
+
+	return strings.Join(words, "")
+}
+
+func (naming idiomaticNaming) capitalize(word string) string {
+	if naming.initialisms[strings.ToUpper(word)] {
+		return strings.ToUpper(word)
+	}
+
+	r, size := utf8.DecodeRuneInString(word)
+	return string(unicode.ToUpper(r)) + word[size:]
+}
+
+func lowerFirst(word string) string {
+	r, size := utf8.DecodeRuneInString(word)
+	return string(unicode.ToLower(r)) + word[size:]
+}
+
+func (naming idiomaticNaming) Getter(field string) string {
+	return naming.Exported(field)
+}
+
+func (naming idiomaticNaming) Setter(field string) string {
+	return "Set" + naming.Exported(field)
+}
+
+func (naming idiomaticNaming) Wither(field string) string {
+	return "With" + naming.Exported(field)
+}
+
+func (naming idiomaticNaming) Receiver(typeName string) string {
+	for _, r := range typeName {
+		return string(unicode.ToLower(r))
+	}
+
+	return "x"
+}
+
+func (naming idiomaticNaming) BuilderReceiver(typeName string) string {
+	return "b"
+}
+
+// legacyNaming reproduces the names builder generated before namings were
+// configurable.
+type legacyNaming struct{}
+
+func (legacyNaming) Exported(name string) string {
+	return strings.Title(name)
+}
+
+func (legacyNaming) Unexported(name string) string {
+	return strings.ToLower(name)
+}
+
+func (legacyNaming) Getter(field string) string {
+	return fmt.Sprintf("Get%s", strings.Title(field))
+}
+
+func (legacyNaming) Setter(field string) string {
+	return fmt.Sprintf("Set%s", strings.Title(field))
+}
+
+func (legacyNaming) Wither(field string) string {
+	return fmt.Sprintf("With%s", strings.Title(field))
+}
+
+func (legacyNaming) Receiver(typeName string) string {
+	return strings.ToLower(typeName)
+}
+
+func (legacyNaming) BuilderReceiver(typeName string) string {
+	return fmt.Sprintf("%sBuilder", strings.ToLower(typeName))
+}
+
+// splitWords splits a camel or snake case identifier, keeping runs of
+// capitals together: "userURLPath" becomes "user", "URL", "Path".
+func splitWords(name string) []string {
+	words := make([]string, 0)
+	runes := []rune(name)
+	start := 0
+	flush := func(end int) {
+		if start < end {
+			words = append(words, string(runes[start:end]))
+		}
+		start = end
+	}
+
+	for i, r := range runes {
+		switch {
+		case r == '_':
+			flush(i)
+			start = i + 1
+		case i == start:
+		case unicode.IsUpper(r) && !unicode.IsUpper(runes[i-1]):
+			flush(i)
+		case unicode.IsUpper(r) && i+1 < len(runes) && unicode.IsLower(runes[i+1]):
+			flush(i)
+		}
+	}
+	flush(len(runes))
+
+	if len(words) <= 0 {
+		return []string{name}
+	}
+
+	return words
+}
@@ -0,0 +1,92 @@
+package builder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"id", []string{"id"}},
+		{"ID", []string{"ID"}},
+		{"userID", []string{"user", "ID"}},
+		{"userURLPath", []string{"user", "URL", "Path"}},
+		{"HTTPServer", []string{"HTTP", "Server"}},
+		{"created_at", []string{"created", "at"}},
+		{"_private", []string{"private"}},
+		{"a__b", []string{"a", "b"}},
+		{"utf8Name", []string{"utf8", "Name"}},
+		{"_", []string{"_"}},
+	}
+
+	for _, tt := range tests {
+		if got := splitWords(tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitWords(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIdiomaticNaming(t *testing.T) {
+	naming := NewIdiomaticNaming("sku")
+	tests := []struct {
+		name       string
+		exported   string
+		unexported string
+	}{
+		{"id", "ID", "id"},
+		{"userId", "UserID", "userID"},
+		{"apiKey", "APIKey", "apiKey"},
+		{"URL", "URL", "url"},
+		{"userURLPath", "UserURLPath", "userURLPath"},
+		{"created_at", "CreatedAt", "createdAt"},
+		{"Name", "Name", "name"},
+		{"skuCode", "SKUCode", "skuCode"},
+		{"json", "JSON", "json"},
+	}
+
+	for _, tt := range tests {
+		if got := naming.Exported(tt.name); got != tt.exported {
+			t.Errorf("Exported(%q) = %q, want %q", tt.name, got, tt.exported)
+		}
+		if got := naming.Unexported(tt.name); got != tt.unexported {
+			t.Errorf("Unexported(%q) = %q, want %q", tt.name, got, tt.unexported)
+		}
+	}
+
+	if got := naming.Getter("userId"); got != "UserID" {
+		t.Errorf("Getter(%q) = %q, want %q", "userId", got, "UserID")
+	}
+	if got := naming.Setter("userId"); got != "SetUserID" {
+		t.Errorf("Setter(%q) = %q, want %q", "userId", got, "SetUserID")
+	}
+	if got := naming.Wither("userId"); got != "WithUserID" {
+		t.Errorf("Wither(%q) = %q, want %q", "userId", got, "WithUserID")
+	}
+}
+
+func TestLegacyNaming(t *testing.T) {
+	naming, err := NamingStrategy(LEGACY_NAMING, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := naming.Exported("userId"); got != "UserId" {
+		t.Errorf("Exported(%q) = %q, want %q", "userId", got, "UserId")
+	}
+	if got := naming.Unexported("createdAt"); got != "createdat" {
+		t.Errorf("Unexported(%q) = %q, want %q", "createdAt", got, "createdat")
+	}
+	if got := naming.Getter("id"); got != "GetId" {
+		t.Errorf("Getter(%q) = %q, want %q", "id", got, "GetId")
+	}
+	if got := naming.BuilderReceiver("User"); got != "userBuilder" {
+		t.Errorf("BuilderReceiver(%q) = %q, want %q", "User", got, "userBuilder")
+	}
+
+	if _, err := NamingStrategy("unknown", nil); err == nil {
+		t.Error("NamingStrategy(\"unknown\") succeeds, want an error")
+	}
+}
@@ -0,0 +1,147 @@
+package builder
+
+import (
+	"fmt"
+	"go/types"
+
+	. "github.com/dave/jennifer/jen"
+)
+
+// nestedBuilder finds the struct whose fluent builder can fill a value of t.
+// only builders whose Build cannot fail qualify, since a setter has no way to
+// report the error.
+func (st PkgStruct) nestedBuilder(t types.Type) (PkgStruct, bool) {
+	named, ok := t.(*types.Named)
+	if !ok || named.TypeParams().Len() > 0 || named.TypeArgs().Len() > 0 {
+		return PkgStruct{}, false
+	}
+
+	child, found := st.index.lookupStruct(named, st.conf)
+	if !found {
+		return st.importedBuilder(named)
+	}
+	if child.generatesStepBuilder() || child.fallibleBuild() || len(child.builderFields()) <= 0 {
+		return PkgStruct{}, false
+	}
+
+	return child, true
+}
+
+// importedBuilder finds the builder of a struct from another package in the
+// type information of that package, which includes its generated files, so
+// that the nested setters do not depend on the packages loaded along. it
+// takes a New<T>Builder returning *<T>Builder, whose Build returns *<T> only.
+func (st PkgStruct) importedBuilder(named *types.Named) (PkgStruct, bool) {
+	pkg := named.Obj().Pkg()
+	if pkg == nil || pkg == st.pkg {
+		return PkgStruct{}, false
+	}
+	child := PkgStruct{pkg: pkg, name: named.Obj().Name()}
+
+	initializer, ok := pkg.Scope().Lookup(child.builderInitializerName()).(*types.Func)
+	if !ok {
+		return PkgStruct{}, false
+	}
+	signature := initializer.Type().(*types.Signature)
+	if signature.TypeParams().Len() > 0 || signature.Params().Len() != 0 || signature.Results().Len() != 1 {
+		return PkgStruct{}, false
+	}
+	pointer, ok := signature.Results().At(0).Type().(*types.Pointer)
+	if !ok {
+		return PkgStruct{}, false
+	}
+	builder, ok := pointer.Elem().(*types.Named)
+	if !ok || builder.Obj().Pkg() != pkg || builder.Obj().Name() != child.builderName() {
+		return PkgStruct{}, false
+	}
+
+	obj, _, _ := types.LookupFieldOrMethod(pointer, false, pkg, "Build")
+	build, ok := obj.(*types.Func)
+	if !ok {
+		return PkgStruct{}, false
+	}
+	signature = build.Type().(*types.Signature)
+	if signature.Params().Len() != 0 || signature.Results().Len() != 1 ||
+		!types.Identical(signature.Results().At(0).Type(), types.NewPointer(named)) {
+		return PkgStruct{}, false
+	}
+
+	return child, true
+}
+
+// defineNestedSetters emits XxxWith for struct fields and AddXxxWith for slice
+// fields, which fill the child with its own builder in place.
+func (st PkgStruct) defineNestedSetters(file *File, field Field) error {
+	builderType := Op("*").Id(st.builderName()).Types(st.typeArgs()...)
+	receiver := st.receiverName()
+	target := Id(receiver).Op(".").Id(field.stateName())
+
+	assigned := Null()
+	if field.opts.Required {
+		assigned = Id(receiver).Op(".").Id(ASSIGNED_FIELD).Op(".").Id(field.Name()).Op("=").True()
+	}
+
+	define := func(name string, child PkgStruct, assign func(built Code) Code) error {
+		ok, err := st.claim(st.builderName(), name, field.Pos(), true)
+		if err != nil || !ok {
+			return err
+		}
+
+		childPkg := child.pkg.Path()
+		build := distinctName(st.local("build"), receiver)
+		nested := distinctName(st.local("nested"), receiver)
+		file.Func().Params(Id(receiver).Add(builderType.Clone())).
+			Id(name).
+			Params(Id(build).Func().Params(Op("*").Qual(childPkg, child.builderName()))).
+			Params(builderType.Clone()).
+			Block(
+				Id(nested).Op(":=").Qual(childPkg, child.builderInitializerName()).Call(),
+				Id(build).Call(Id(nested)),
+				assign(Id(nested).Dot("Build").Call()),
+				assigned,
+				Return(Id(receiver)),
+			).
+			Line()
+
+		return nil
+	}
+
+	elemOf := func(t types.Type) (PkgStruct, bool, bool) {
+		if pointer, ok := t.(*types.Pointer); ok {
+			child, found := st.nestedBuilder(pointer.Elem())
+			return child, true, found
+		}
+		child, found := st.nestedBuilder(t)
+		return child, false, found
+	}
+
+	if child, isPointer, found := elemOf(field.Type()); found {
+		return define(fmt.Sprintf("%sWith", field.builderMethodName()), child, func(built Code) Code {
+			if isPointer {
+				return Add(target.Clone()).Op("=").Add(built)
+			}
+			return Add(target.Clone()).Op("=").Op("*").Add(built)
+		})
+	}
+
+	slice, ok := field.Type().Underlying().(*types.Slice)
+	if !ok {
+		return nil
+	}
+	singular, found := field.singularName()
+	if !found {
+		return nil
+	}
+	if child, isPointer, found := elemOf(slice.Elem()); found {
+		// clipped like AddX, so that builders seeded alike never share the array
+		clipped := target.Clone().Index(Empty(), Len(target.Clone()), Len(target.Clone()))
+		return define(fmt.Sprintf("Add%sWith", singular), child, func(built Code) Code {
+			if isPointer {
+				return Add(target.Clone()).Op("=").Append(clipped.Clone(), built)
+			}
+			return Add(target.Clone()).Op("=").Append(clipped.Clone(), Op("*").Add(built))
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package builder
+
+import (
+	"fmt"
+	"strings"
+
+	. "github.com/dave/jennifer/jen"
+)
+
+const OPTIONS_DIRECTIVE = "options"
+
+func (st PkgStruct) optionName() string {
+	return fmt.Sprintf("%sOption", strings.Title(st.name))
+}
+
+// optionFuncName names the option setting field. options live at package
+// level, so those of structs sharing a field collide and are claimed first
+// come, first served.
+func (st PkgStruct) optionFuncName(field Field) string {
+	return fmt.Sprintf("With%s", field.builderMethodName())
+}
+
+func (st PkgStruct) optionsConstructorName() string {
+	return fmt.Sprintf("New%s", strings.Title(st.name))
+}
+
+func (st PkgStruct) generatesOptions() bool {
+	if st.conf.Options {
+		return true
+	}
+
+	_, found := st.directives.Lookup(OPTIONS_DIRECTIVE)
+	return found
+}
+
+// DefineOptions emits the functional options flavor of the builder: an option
+// func type, a WithXxx constructor per field and a NewXxx that applies them.
+func (st PkgStruct) DefineOptions(file *File) error {
+	if !st.generatesOptions() || len(st.builderFields()) <= 0 {
+		return nil
+	}
+
+	// without its option type and constructor the struct gets no options
+	for _, name := range []string{st.optionName(), st.optionsConstructorName()} {
+		ok, err := st.claim("", name, st.named.Obj().Pos(), true)
+		if err != nil || !ok {
+			return err
+		}
+	}
+
+	option := st.optionName()
+	receiver := st.entityReceiverName()
+	entityType := Op("*").Id(st.name).Types(st.typeArgs()...)
+
+	file.Type().Id(option).Types(st.typeParamsDecl()...).Func().Params(entityType.Clone())
+
+	for _, field := range st.builderFields() {
+		if field.opts.Omit {
+			continue
+		}
+
+		wither := st.optionFuncName(field)
+		ok, err := st.claim("", wither, field.Pos(), true)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		argument := st.argumentName(field, receiver)
+		file.Func().
+			Id(wither).Types(st.typeParamsDecl()...).
+			Params(Id(argument).Add(typeCode(field.Type()))).
+			Params(Id(option).Types(st.typeArgs()...)).
+			Block(
+				Return(
+					Func().Params(Id(receiver).Add(entityType.Clone())).Block(
+						Id(receiver).Op(".").Id(field.Name()).Op("=").Id(argument),
+					),
+				),
+			).
+			Line()
+	}
+
+	defaults, err := st.defaultValues()
+	if err != nil {
+		return err
+	}
+
+	opts := distinctName(st.local("opts"), receiver)
+	opt := distinctName(st.local("opt"), receiver)
+
+	body := []Code{
+		Id(receiver).Op(":=").Add(st.entityLiteral(defaults)),
+		For(List(Id("_"), Id(opt)).Op(":=").Range().Id(opts)).Block(
+			Id(opt).Call(Id(receiver)),
+		),
+	}
+	results := []Code{entityType.Clone()}
+	if st.validate != "" {
+		body = append(body,
+			If(Err().Op(":=").Id(receiver).Dot(st.validate).Call(), Err().Op("!=").Nil()).Block(
+				Return(Nil(), Err()),
+			),
+			Return(Id(receiver), Nil()),
+		)
+		results = append(results, Error())
+	} else {
+		body = append(body, Return(Id(receiver)))
+	}
+
+	file.Func().
+		Id(st.optionsConstructorName()).Types(st.typeParamsDecl()...).
+		Params(Id(opts).Op("...").Id(option).Types(st.typeArgs()...)).
+		Params(results...).
+		Block(body...).
+		Line()
+
+	return nil
+}
@@ -1,35 +1,48 @@
 package builder
 
 import (
-	"errors"
 	"fmt"
 	"go/ast"
-	"go/importer"
-	"go/parser"
 	"go/token"
 	"go/types"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
 )
 
+const LOAD_MODE = packages.NeedName |
+	packages.NeedFiles |
+	packages.NeedDeps |
+	packages.NeedImports |
+	packages.NeedTypes |
+	packages.NeedSyntax |
+	packages.NeedTypesInfo
+
 type Package struct {
-	fset    *token.FileSet
-	astPkg  *ast.Package
-	PkgName string
+	fset          *token.FileSet
+	astFiles      []*ast.File
+	excludedFiles map[string]bool
+	typesPkg      *types.Package
+	PkgName       string
+	PkgPath       string
+	// siblings are all packages loaded together, by import path
+	siblings map[string]*Package
+	index    *packageIndex
 }
 
-type FileLoadFilterFunc func(info os.FileInfo) bool
+// FileLoadFilterFunc reports whether the file is loaded as part of the package.
+type FileLoadFilterFunc func(fileName string) (bool, error)
 
-func (pkg *Package) packageFiles() map[string]*ast.File {
-	if pkg.astPkg == nil {
-		return make(map[string]*ast.File)
+func (pkg *Package) ParsePkgFiles(conf Config) (files []PkgFile) {
+	if pkg.typesPkg == nil {
+		return
 	}
 
-	return pkg.astPkg.Files
-}
-
-func (pkg *Package) ParsePkgFiles() (files []PkgFile) {
-	for _, f := range pkg.packageFiles() {
+	index := pkg.packageIndex()
+	for _, f := range pkg.astFiles {
 		gendecls := make([]*ast.GenDecl, 0, len(f.Decls))
 		for _, decl := range f.Decls {
 			gendecl, ok := decl.(*ast.GenDecl)
@@ -39,27 +52,17 @@ func (pkg *Package) ParsePkgFiles() (files []PkgFile) {
 			gendecls = append(gendecls, gendecl)
 		}
 
-		conf := types.Config{
-			Importer: importer.Default(),
-			Error: func(err error) {
-				fmt.Printf("!!! %#v\n", err)
-			},
-		}
-
-		// limit access over files in same package
-		pkgMeta, err := conf.Check(f.Name.String(), pkg.fset, []*ast.File{f}, nil)
-		if err != nil {
-			fmt.Printf("!!! %#v\n", err)
-			continue
-		}
-
 		file := PkgFile{
 			astFile:  f,
 			fset:     pkg.fset,
 			gendecls: gendecls,
 			FileName: pkg.fset.File(f.Pos()).Name(),
 			PkgName:  f.Name.String(),
-			pkgScope: pkgMeta.Scope(),
+			PkgPath:  pkg.PkgPath,
+			pkgScope: pkg.typesPkg.Scope(),
+			typesPkg: pkg.typesPkg,
+			conf:     conf,
+			index:    index,
 		}
 		files = append(files, file)
 	}
@@ -67,34 +70,112 @@ func (pkg *Package) ParsePkgFiles() (files []PkgFile) {
 	return
 }
 
-func LoadPackage(pkgDir string, filter FileLoadFilterFunc) (pkg *Package, err error) {
-	fset := token.NewFileSet()
-	pkgm, err := parser.ParseDir(
-		fset,
-		filepath.FromSlash(pkgDir),
-		filter,
-		parser.ParseComments,
-	)
+// ExcludedFiles lists the files of the package left out by the load filter.
+func (pkg *Package) ExcludedFiles() []string {
+	files := make([]string, 0, len(pkg.excludedFiles))
+	for fileName := range pkg.excludedFiles {
+		files = append(files, fileName)
+	}
+	sort.Strings(files)
+
+	return files
+}
+
+func (pkg *Package) packageIndex() *packageIndex {
+	if pkg.index == nil {
+		pkg.index = newPackageIndex(pkg)
+	}
+
+	return pkg.index
+}
+
+// LoadPackages resolves patterns through the go command so that go.mod, vendor,
+// build tags and GOFLAGS are honored. a bare directory is treated as "./dir".
+// packages loaded together know about each other's structs.
+func LoadPackages(patterns []string, filter FileLoadFilterFunc) (pkgs []*Package, err error) {
+	conf := &packages.Config{
+		Mode: LOAD_MODE,
+	}
+
+	normalized := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		normalized = append(normalized, normalizePattern(pattern))
+	}
+
+	loaded, err := packages.Load(conf, normalized...)
 	if err != nil {
 		return
 	}
-	if len(pkgm) <= 0 {
-		pkg = &Package{fset: fset}
+	if len(loaded) <= 0 {
+		err = fmt.Errorf("no packages matched %q", strings.Join(patterns, " "))
 		return
 	}
 
-	for k, v := range pkgm {
-		if pkg != nil {
-			err = errors.New("must be single package dir")
-			return
+	siblings := make(map[string]*Package, len(loaded))
+	for _, p := range loaded {
+		// type errors are reported but do not abort loading, since the
+		// partially checked package still describes most of its structs.
+		// they are errors rather than notices, so they are never silenced.
+		for _, pkgErr := range p.Errors {
+			fmt.Fprintf(os.Stderr, "!!! %v\n", pkgErr)
+		}
+		if p.Types == nil || len(p.Syntax) <= 0 {
+			continue
+		}
+
+		pkg := &Package{
+			fset:          p.Fset,
+			excludedFiles: make(map[string]bool),
+			typesPkg:      p.Types,
+			PkgName:       p.Name,
+			PkgPath:       p.PkgPath,
+			siblings:      siblings,
 		}
+		siblings[p.PkgPath] = pkg
 
-		pkg = &Package{
-			fset:    fset,
-			astPkg:  v,
-			PkgName: k,
+		for _, f := range p.Syntax {
+			// files that could not be parsed at all carry no position
+			tokenFile := p.Fset.File(f.Pos())
+			if tokenFile == nil {
+				continue
+			}
+
+			included := true
+			if filter != nil {
+				included, err = filter(tokenFile.Name())
+				if err != nil {
+					return
+				}
+			}
+			if !included {
+				pkg.excludedFiles[tokenFile.Name()] = true
+				continue
+			}
+			pkg.astFiles = append(pkg.astFiles, f)
 		}
+		sort.Slice(pkg.astFiles, func(i, j int) bool {
+			return p.Fset.File(pkg.astFiles[i].Pos()).Name() < p.Fset.File(pkg.astFiles[j].Pos()).Name()
+		})
+
+		pkgs = append(pkgs, pkg)
+	}
+
+	if len(pkgs) <= 0 {
+		err = fmt.Errorf("no loadable packages for %q", strings.Join(patterns, " "))
 	}
 
 	return
 }
+
+func normalizePattern(pattern string) string {
+	if filepath.IsAbs(pattern) || strings.HasPrefix(pattern, ".") {
+		return pattern
+	}
+
+	dir := strings.TrimSuffix(pattern, "/...")
+	if info, err := os.Stat(filepath.FromSlash(dir)); err == nil && info.IsDir() {
+		return "./" + pattern
+	}
+
+	return pattern
+}
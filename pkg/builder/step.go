@@ -0,0 +1,175 @@
+package builder
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	. "github.com/dave/jennifer/jen"
+)
+
+const STEP_DIRECTIVE = "step"
+
+func (st PkgStruct) generatesStepBuilder() bool {
+	if st.conf.Step {
+		return true
+	}
+
+	_, found := st.directives.Lookup(STEP_DIRECTIVE)
+	return found
+}
+
+func (st PkgStruct) stepBuilderName() string {
+	r, size := utf8.DecodeRuneInString(st.name)
+	return fmt.Sprintf("%c%sStepBuilder", unicode.ToLower(r), st.name[size:])
+}
+
+func (st PkgStruct) stepName(field Field) string {
+	return fmt.Sprintf("%s%sStep", strings.Title(st.name), field.builderMethodName())
+}
+
+func (st PkgStruct) optionalStepName() string {
+	return fmt.Sprintf("%sOptionalStep", strings.Title(st.name))
+}
+
+// DefineStepBuilder emits the type-state flavor of the builder. every
+// required field gets its own step interface, in declaration order, whose
+// only method leads to the next step, so Build is reachable only once all of
+// them have been supplied. optional fields and Build hang off the last step.
+func (st PkgStruct) DefineStepBuilder(file *File) error {
+	if len(st.builderFields()) <= 0 {
+		return nil
+	}
+
+	required := st.requiredFields()
+	steps := make([]string, 0, len(required)+1)
+	for _, field := range required {
+		steps = append(steps, st.stepName(field))
+	}
+	steps = append(steps, st.optionalStepName())
+
+	stepType := func(name string) *Statement {
+		return Id(name).Types(st.typeArgs()...)
+	}
+	builtType := Op("*").Id(st.name).Types(st.typeArgs()...)
+	buildResults := []Code{builtType.Clone()}
+	if st.fallibleBuild() {
+		buildResults = append(buildResults, Error())
+	}
+
+	// the interfaces must agree with the methods actually emitted
+	builder := st.stepBuilderName()
+	skipped := make(map[string]bool)
+	for _, field := range st.builderFields() {
+		if field.opts.Omit {
+			continue
+		}
+
+		ok, err := st.claim(builder, field.builderMethodName(), field.Pos(), !field.opts.Required)
+		if err != nil {
+			return err
+		}
+		skipped[field.Name()] = !ok
+	}
+
+	for i, field := range required {
+		file.Type().Id(steps[i]).Types(st.typeParamsDecl()...).Interface(
+			Id(field.builderMethodName()).
+				Params(Id(st.argumentName(field, "")).Add(typeCode(field.Type()))).
+				Add(stepType(steps[i+1])),
+		).
+			Line()
+	}
+
+	optionals := make([]Code, 0)
+	for _, field := range st.builderFields() {
+		if field.opts.Omit || field.opts.Required || skipped[field.Name()] {
+			continue
+		}
+
+		optionals = append(optionals,
+			Id(field.builderMethodName()).
+				Params(Id(st.argumentName(field, "")).Add(typeCode(field.Type()))).
+				Add(stepType(st.optionalStepName())),
+		)
+	}
+	optionals = append(optionals, Id("Build").Params().Params(buildResults...))
+	if st.fallibleBuild() {
+		optionals = append(optionals, Id("MustBuild").Params().Add(builtType.Clone()))
+	}
+	file.Type().Id(st.optionalStepName()).Types(st.typeParamsDecl()...).Interface(optionals...).
+		Line()
+
+	fields := make([]Code, 0)
+	for _, field := range st.builderFields() {
+		fields = append(fields, Id(field.stateName()).Add(typeCode(field.Type())))
+	}
+	file.Type().Id(builder).Types(st.typeParamsDecl()...).Struct(fields...).
+		Line()
+
+	defaults, err := st.defaultValues()
+	if err != nil {
+		return err
+	}
+	file.Func().
+		Id(st.builderInitializerName()).Types(st.typeParamsDecl()...).Params().
+		Add(stepType(steps[0])).
+		Block(
+			Return(
+				Op("&").Id(builder).Types(st.typeArgs()...).Values(st.stateDict(defaults)),
+			),
+		).
+		Line()
+
+	receiver := st.receiverName()
+	receiverType := Op("*").Id(builder).Types(st.typeArgs()...)
+	next := make(map[string]string)
+	for i, field := range required {
+		next[field.Name()] = steps[i+1]
+	}
+	for _, field := range st.builderFields() {
+		if field.opts.Omit || skipped[field.Name()] {
+			continue
+		}
+
+		nextStep, found := next[field.Name()]
+		if !found {
+			nextStep = st.optionalStepName()
+		}
+
+		argument := st.argumentName(field, receiver)
+		file.Func().Params(Id(receiver).Add(receiverType.Clone())).
+			Id(field.builderMethodName()).
+			Params(Id(argument).Add(typeCode(field.Type()))).
+			Add(stepType(nextStep)).
+			Block(
+				Id(receiver).Op(".").Id(field.stateName()).Op("=").Id(argument),
+				Return(Id(receiver)),
+			).
+			Line()
+	}
+
+	entity := st.builtValue(receiver)
+	if !st.fallibleBuild() {
+		file.Func().Params(Id(receiver).Add(receiverType.Clone())).
+			Id("Build").
+			Params().
+			Params(buildResults...).
+			Block(
+				Return(entity),
+			).
+			Line()
+		return nil
+	}
+
+	file.Func().Params(Id(receiver).Add(receiverType.Clone())).
+		Id("Build").
+		Params().
+		Params(buildResults...).
+		Block(st.validatedReturn(entity, receiver)...).
+		Line()
+	st.defineMustBuild(file, receiver, receiverType.Clone())
+
+	return nil
+}
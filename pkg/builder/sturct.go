@@ -6,6 +6,7 @@ import (
 	"go/types"
 	"reflect"
 	"strings"
+	"unicode"
 
 	. "github.com/dave/jennifer/jen"
 )
@@ -13,22 +14,79 @@ import (
 const (
 	GETTER_TAG_VALUE = "get"
 	SETTER_TAG_VALUE = "set"
+	WITHER_TAG_VALUE = "with"
 	BUILD_TAG_VALUE  = "build"
+
+	REQUIRED_OPTION = "required"
+
+	ASSIGNED_FIELD = "assigned"
 )
 
 type PkgStruct struct {
-	fset *token.FileSet
-	name string
-	meta *types.Struct
+	fset       *token.FileSet
+	pkg        *types.Package
+	name       string
+	meta       *types.Struct
+	typeParams *types.TypeParamList
+	directives Directives
+	validate   string
+	conf       Config
+	index      *packageIndex
+	named      *types.Named
+	fields     []Field
+	// reserved holds the identifiers locals of the generated code must avoid
+	reserved map[string]bool
 }
 
 type Field struct {
-	tag string
+	tag  string
+	opts FieldOptions
 	*types.Var
+	// embedded is the embedded struct field a flattened field is promoted from
+	embedded *types.Var
+	naming   Naming
 }
 
+// receiverName names the receiver of builder methods, reusing the one of
+// hand-written methods on the builder if there are any.
 func (st PkgStruct) receiverName() string {
-	return fmt.Sprintf("%sBuilder", strings.ToLower(st.name))
+	builder := st.builderName()
+	if st.generatesStepBuilder() {
+		builder = st.stepBuilderName()
+	}
+	if obj, ok := st.pkg.Scope().Lookup(builder).(*types.TypeName); ok {
+		if named, ok := obj.Type().(*types.Named); ok {
+			if receiver, found := st.index.handWrittenReceiver(named); found {
+				return receiver
+			}
+		}
+	}
+
+	return st.conf.naming().BuilderReceiver(st.name)
+}
+
+// entityReceiverName names the receiver of entity methods, reusing the one of
+// hand-written methods on the entity if there are any.
+func (st PkgStruct) entityReceiverName() string {
+	if receiver, found := st.index.handWrittenReceiver(st.named); found {
+		return receiver
+	}
+
+	return st.conf.naming().Receiver(st.name)
+}
+
+// argumentName names the parameter carrying field, keeping it apart from the
+// receiver it would otherwise shadow.
+func (st PkgStruct) argumentName(field Field, receiver string) string {
+	return parameterName(st.conf.naming().Unexported(field.Name()), receiver, st.fset.Position(field.Pos()))
+}
+
+func distinctName(name string, receiver string) string {
+	if name == receiver {
+		return name + "Value"
+	}
+
+	return name
 }
 
 func (st PkgStruct) builderName() string {
@@ -39,38 +97,51 @@ func (st PkgStruct) builderInitializerName() string {
 	return fmt.Sprintf("New%sBuilder", strings.Title(st.name))
 }
 
-func (st PkgStruct) DefineBuilderInitializer(file *File) {
-	if len(st.filterOpenedFields()) <= 0 {
-		return
+func (st PkgStruct) missingFieldsErrorName() string {
+	return fmt.Sprintf("%sMissingFieldsError", strings.Title(st.name))
+}
+
+func (st PkgStruct) typeParamsDecl() []Code {
+	return typeParamsCode(st.typeParams)
+}
+
+func (st PkgStruct) typeArgs() []Code {
+	return typeArgsCode(st.typeParams)
+}
+
+func (st PkgStruct) DefineBuilderInitializer(file *File) error {
+	if len(st.builderFields()) <= 0 {
+		return nil
+	}
+
+	defaults, err := st.defaultValues()
+	if err != nil {
+		return err
 	}
 
 	builder := st.builderName()
 	initializer := st.builderInitializerName()
 	file.Func().
-		Id(initializer).Params().
-		Params(Op("*").Id(builder)).
+		Id(initializer).Types(st.typeParamsDecl()...).Params().
+		Params(Op("*").Id(builder).Types(st.typeArgs()...)).
 		Block(
 			Return(
-				Op("&").Id(builder).Block(),
+				Op("&").Id(builder).Types(st.typeArgs()...).Values(st.stateDict(defaults)),
 			),
 		).
 		Line()
+
+	return nil
 }
 
 func (st PkgStruct) DefineBuilderStruct(file *File) {
 	fields := make([]Code, 0, st.meta.NumFields())
-	for _, fld := range st.filterOpenedFields() {
+	for _, fld := range st.builderFields() {
 		if len(fld.Name()) <= 0 {
 			continue
 		}
 
-		fieldName := fld.Type().String()
-		typeIdx := strings.LastIndex(fieldName, ".")
-		if 0 < typeIdx {
-			fieldName = fieldName[typeIdx+1:]
-		}
-
-		field := Id(fld.Name()).Id(fieldName)
+		field := Id(fld.stateName()).Add(typeCode(fld.Type()))
 		fields = append(fields, field)
 	}
 
@@ -78,79 +149,343 @@ func (st PkgStruct) DefineBuilderStruct(file *File) {
 		return
 	}
 
+	if 0 < len(st.requiredFields()) {
+		fields = append(fields, Id(ASSIGNED_FIELD).Struct(st.assignedFields()...))
+	}
+
 	builder := st.builderName()
-	file.Type().Id(builder).Struct(fields...)
+	file.Type().Id(builder).Types(st.typeParamsDecl()...).Struct(fields...)
 }
 
-func (st PkgStruct) DefineBuilderConstructors(file *File) {
+func (st PkgStruct) DefineBuilderConstructors(file *File) error {
 	builder := st.builderName()
 	receiver := st.receiverName()
-	for _, field := range st.filterOpenedFields() {
-		if len(field.Name()) <= 0 {
+	for _, field := range st.builderFields() {
+		if len(field.Name()) <= 0 || field.opts.Omit {
+			continue
+		}
+
+		// a required field without setter could never be built
+		ok, err := st.claim(builder, field.builderMethodName(), field.Pos(), !field.opts.Required)
+		if err != nil {
+			return err
+		}
+		if !ok {
 			continue
 		}
 
-		argType := field.Type().String()
-		idef := strings.Title(field.Name())
-		argment := strings.ToLower(field.Name())
+		argment := st.argumentName(field, receiver)
 
-		typeIdx := strings.LastIndex(argType, ".")
-		if 0 < typeIdx {
-			argType = argType[typeIdx+1:]
+		body := []Code{
+			Id(receiver).Op(".").Id(field.stateName()).Op("=").Id(argment),
+		}
+		if field.opts.Required {
+			body = append(body, Id(receiver).Op(".").Id(ASSIGNED_FIELD).Op(".").Id(field.Name()).Op("=").True())
 		}
+		body = append(body, Return(Id(receiver)))
 
-		build, _ := field.BuildTagValue()
-		if build == "-" {
-			continue
+		file.Func().Params(Id(receiver).Op("*").Id(builder).Types(st.typeArgs()...)).
+			Id(field.builderMethodName()).
+			Params(Id(argment).Add(typeCode(field.Type()))).
+			Params(Op("*").Id(builder).Types(st.typeArgs()...)).
+			Block(body...).
+			Line()
+
+		if err := st.defineCollectionHelpers(file, field); err != nil {
+			return err
 		}
-		if build != "" {
-			idef = build
+		if err := st.defineNestedSetters(file, field); err != nil {
+			return err
 		}
+	}
+
+	return nil
+}
+
+func (st PkgStruct) DefineBuildFunc(file *File) {
+	builder := st.builderName()
+	receiver := st.receiverName()
+	entity := st.builtValue(receiver)
+	if entity == nil {
+		return
+	}
 
-		file.Func().Params(Id(receiver).Op("*").Id(builder)).
-			Id(idef).
-			Params(Id(argment).Id(argType)).
-			Params(Op("*").Id(builder)).
+	if !st.fallibleBuild() {
+		file.Func().Params(Id(receiver).Id(builder).Types(st.typeArgs()...)).
+			Id("Build").
+			Params().
+			Params(Op("*").Id(st.name).Types(st.typeArgs()...)).
 			Block(
-				Id(receiver).Op(".").Id(field.Name()).Op("=").Id(strings.ToLower(field.Name())),
-				Return(Id(receiver)),
+				Return(entity),
 			).
 			Line()
+		return
 	}
+
+	checks := make([]Code, 0)
+	if required := st.requiredFields(); 0 < len(required) {
+		missing := distinctName(st.local("missing"), receiver)
+		checks = append(checks, Var().Id(missing).Index().String())
+		for _, field := range required {
+			checks = append(checks,
+				If(Op("!").Id(receiver).Op(".").Id(ASSIGNED_FIELD).Op(".").Id(field.Name())).Block(
+					Id(missing).Op("=").Append(Id(missing), Lit(field.builderMethodName())),
+				),
+			)
+		}
+		checks = append(checks,
+			If(Op("0").Op("<").Len(Id(missing))).Block(
+				Return(Nil(), Op("&").Id(st.missingFieldsErrorName()).Values(Dict{
+					Id("Fields"): Id(missing),
+				})),
+			),
+			Line(),
+		)
+	}
+
+	checks = append(checks, st.validatedReturn(entity, receiver)...)
+
+	file.Func().Params(Id(receiver).Id(builder).Types(st.typeArgs()...)).
+		Id("Build").
+		Params().
+		Params(Op("*").Id(st.name).Types(st.typeArgs()...), Error()).
+		Block(checks...).
+		Line()
+
+	st.defineMustBuild(file, receiver, Id(builder).Types(st.typeArgs()...))
 }
 
-func (st PkgStruct) DefineBuildFunc(file *File) {
-	dict := Dict{}
+// DefineToBuilder emits a method on the entity returning a builder seeded
+// with every field the builder knows about.
+func (st PkgStruct) DefineToBuilder(file *File) error {
+	fields := st.builderFields()
+	if len(fields) <= 0 {
+		return nil
+	}
+
+	ok, err := st.claim(st.name, "ToBuilder", st.named.Obj().Pos(), true)
+	if err != nil || !ok {
+		return err
+	}
+
+	receiver := st.entityReceiverName()
 	builder := st.builderName()
-	receiver := st.receiverName()
-	for _, field := range st.filterOpenedFields() {
+	resultType := Op("*").Id(builder).Types(st.typeArgs()...)
+	if st.generatesStepBuilder() {
+		builder = st.stepBuilderName()
+		resultType = Id(st.optionalStepName()).Types(st.typeArgs()...)
+	}
+
+	values := make(map[string]Code)
+	for _, field := range fields {
+		values[field.Name()] = st.detached(field, Id(receiver).Op(".").Id(field.Name()))
+	}
+	seeded := Op("&").Id(builder).Types(st.typeArgs()...).Values(st.stateDict(values))
+
+	body := []Code{Return(seeded)}
+	if required := st.requiredFields(); 0 < len(required) && !st.generatesStepBuilder() {
+		seeder := distinctName(st.receiverName(), receiver)
+		body = []Code{Id(seeder).Op(":=").Add(seeded)}
+		for _, field := range required {
+			body = append(body, Id(seeder).Op(".").Id(ASSIGNED_FIELD).Op(".").Id(field.Name()).Op("=").True())
+		}
+		body = append(body, Return(Id(seeder)))
+	}
+
+	file.Func().Params(Id(receiver).Op("*").Id(st.name).Types(st.typeArgs()...)).
+		Id("ToBuilder").
+		Params().
+		Params(resultType).
+		Block(body...).
+		Line()
+
+	return nil
+}
+
+func (st PkgStruct) defineMustBuild(file *File, receiver string, receiverType Code) {
+	built := distinctName(st.local("built"), receiver)
+	file.Func().Params(Id(receiver).Add(receiverType)).
+		Id("MustBuild").
+		Params().
+		Params(Op("*").Id(st.name).Types(st.typeArgs()...)).
+		Block(
+			List(Id(built), Err()).Op(":=").Id(receiver).Dot("Build").Call(),
+			If(Err().Op("!=").Nil()).Block(
+				Panic(Err()),
+			),
+			Return(Id(built)),
+		).
+		Line()
+}
+
+// builtValue renders the entity literal copying every builder field, or nil
+// when the builder holds no fields.
+func (st PkgStruct) builtValue(receiver string) *Statement {
+	values := make(map[string]Code)
+	for _, field := range st.builderFields() {
 		if len(field.Name()) <= 0 {
 			continue
 		}
 
-		dict[Id(field.Name())] = Id(receiver).Op(".").Id(field.Name())
+		values[field.Name()] = st.detached(field, Id(receiver).Op(".").Id(field.stateName()))
+	}
+
+	if len(values) <= 0 {
+		return nil
 	}
 
-	if len(dict) <= 0 {
+	return st.entityLiteral(values)
+}
+
+// entityLiteral renders a pointer to an entity literal holding values, keyed
+// by field name. promoted fields cannot be named in a literal, so flattened
+// ones are composed into their embedded struct.
+func (st PkgStruct) entityLiteral(values map[string]Code) *Statement {
+	dict := Dict{}
+	flattened := make(map[*types.Var]Dict)
+	for _, field := range st.builderFields() {
+		value, found := values[field.Name()]
+		if !found {
+			continue
+		}
+
+		if field.embedded != nil {
+			if _, found := flattened[field.embedded]; !found {
+				flattened[field.embedded] = Dict{}
+			}
+			flattened[field.embedded][Id(field.Name())] = value
+			continue
+		}
+		dict[Id(field.Name())] = value
+	}
+	for embedded, values := range flattened {
+		dict[Id(embedded.Name())] = Add(typeCode(embedded.Type())).Values(values)
+	}
+
+	return Op("&").Id(st.name).Types(st.typeArgs()...).Values(dict)
+}
+
+// validatedReturn returns entity and a nil error, running the validate
+// method on it first when the struct opted into validation.
+func (st PkgStruct) validatedReturn(entity Code, receiver string) []Code {
+	if st.validate == "" {
+		return []Code{Return(entity, Nil())}
+	}
+
+	built := distinctName(st.local("built"), receiver)
+	return []Code{
+		Id(built).Op(":=").Add(entity),
+		If(Err().Op(":=").Id(built).Dot(st.validate).Call(), Err().Op("!=").Nil()).Block(
+			Return(Nil(), Err()),
+		),
+		Return(Id(built), Nil()),
+	}
+}
+
+func (st PkgStruct) defaultValues() (map[string]Code, error) {
+	defaults := make(map[string]Code)
+	for _, field := range st.builderFields() {
+		if !field.opts.HasDefault {
+			continue
+		}
+
+		value, err := st.defaultValueCode(field, field.opts.Default)
+		if err != nil {
+			return nil, err
+		}
+		defaults[field.Name()] = value
+	}
+
+	return defaults, nil
+}
+
+// stateDict renders values, keyed by field name, as builder literal entries.
+func (st PkgStruct) stateDict(values map[string]Code) Dict {
+	dict := Dict{}
+	for _, field := range st.builderFields() {
+		if value, found := values[field.Name()]; found {
+			dict[Id(field.stateName())] = value
+		}
+	}
+
+	return dict
+}
+
+func (st PkgStruct) DefineMissingFieldsError(file *File) {
+	if len(st.requiredFields()) <= 0 {
 		return
 	}
 
-	file.Func().Params(Id(receiver).Id(builder)).
-		Id("Build").
+	errName := st.missingFieldsErrorName()
+	file.Type().Id(errName).Struct(
+		Id("Fields").Index().String(),
+	)
+
+	file.Func().Params(Id("err").Op("*").Id(errName)).
+		Id("Error").
 		Params().
-		Params(Op("*").Id(st.name)).
+		Params(String()).
 		Block(
 			Return(
-				Op("&").Id(st.name).Values(dict),
+				Lit(fmt.Sprintf("%s: missing required fields: ", st.name)).
+					Op("+").
+					Qual("strings", "Join").Call(Id("err").Dot("Fields"), Lit(", ")),
 			),
-		)
+		).
+		Line()
 }
 
-func (f Field) BuildTagValue() (buildname string, found bool) {
-	buildname, found = reflect.StructTag(f.tag).Lookup(BUILD_TAG_VALUE)
+func (st PkgStruct) fallibleBuild() bool {
+	// step builders enforce required fields at compile time
+	if st.generatesStepBuilder() {
+		return st.validate != ""
+	}
+
+	return 0 < len(st.requiredFields()) || st.validate != ""
+}
+
+func (st PkgStruct) assignedFields() []Code {
+	required := st.requiredFields()
+	assigned := make([]Code, 0, len(required))
+	for _, field := range required {
+		assigned = append(assigned, Id(field.Name()).Bool())
+	}
+
+	return assigned
+}
+
+func (st PkgStruct) requiredFields() (fields []Field) {
+	for _, field := range st.builderFields() {
+		if field.opts.Required {
+			fields = append(fields, field)
+		}
+	}
+
 	return
 }
 
+// stateName is the name of the builder field holding f. exported names would
+// clash with the setters, so their leading capitals are lowered.
+func (f Field) stateName() string {
+	if !f.Exported() {
+		return f.Name()
+	}
+
+	return lowerInitial(f.Name())
+}
+
+func (f Field) Options() FieldOptions {
+	return f.opts
+}
+
+func (f Field) builderMethodName() string {
+	if f.opts.Name != "" {
+		return f.opts.Name
+	}
+
+	return f.naming.Exported(f.Name())
+}
+
 func (f Field) GetterTagValue() (gettername string, found bool) {
 	gettername, found = reflect.StructTag(f.tag).Lookup(GETTER_TAG_VALUE)
 	return
@@ -161,30 +496,39 @@ func (f Field) SetterTagValue() (settername string, found bool) {
 	return
 }
 
-func (st PkgStruct) DefineAccessors(file *File) {
-	// getter
-	{
-		receiver := strings.ToLower(st.name)
-		for _, field := range st.filterOpenedFields() {
-			argType := field.Type().String()
+func (f Field) WitherTagValue() (withername string, found bool) {
+	withername, found = reflect.StructTag(f.tag).Lookup(WITHER_TAG_VALUE)
+	return
+}
 
-			typeIdx := strings.LastIndex(argType, ".")
-			if 0 < typeIdx {
-				argType = argType[typeIdx+1:]
-			}
+func (st PkgStruct) DefineAccessors(file *File) error {
+	if st.immutable() {
+		return st.defineImmutableAccessors(file)
+	}
 
+	// getter
+	{
+		receiver := st.entityReceiverName()
+		for _, field := range st.accessorFields() {
 			getter, found := field.GetterTagValue()
 			if !found {
 				continue
 			}
 			if getter == "" {
-				getter = fmt.Sprintf("Get%s", strings.Title(field.Name()))
+				getter = st.conf.naming().Getter(field.Name())
+			}
+			ok, err := st.claim(st.name, getter, field.Pos(), true)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
 			}
 
-			file.Func().Params(Id(receiver).Op("*").Id(st.name)).
+			file.Func().Params(Id(receiver).Op("*").Id(st.name).Types(st.typeArgs()...)).
 				Id(getter).
 				Params().
-				Params(Id(argType)).
+				Params(typeCode(field.Type())).
 				Block(
 					Return(Id(receiver).Op(".").Id(field.Name())),
 				).
@@ -194,27 +538,28 @@ func (st PkgStruct) DefineAccessors(file *File) {
 
 	// setter
 	{
-		receiver := strings.ToLower(st.name)
-		for _, field := range st.filterOpenedFields() {
-			argType := field.Type().String()
-			argument := strings.ToLower(field.Name())
-
-			typeIdx := strings.LastIndex(argType, ".")
-			if 0 < typeIdx {
-				argType = argType[typeIdx+1:]
-			}
+		receiver := st.entityReceiverName()
+		for _, field := range st.accessorFields() {
+			argument := st.argumentName(field, receiver)
 
 			setter, found := field.SetterTagValue()
 			if !found {
 				continue
 			}
 			if setter == "" {
-				setter = fmt.Sprintf("Set%s", strings.Title(field.Name()))
+				setter = st.conf.naming().Setter(field.Name())
+			}
+			ok, err := st.claim(st.name, setter, field.Pos(), true)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
 			}
 
-			file.Func().Params(Id(receiver).Op("*").Id(st.name)).
+			file.Func().Params(Id(receiver).Op("*").Id(st.name).Types(st.typeArgs()...)).
 				Id(setter).
-				Params(Id(argument).Id(argType)).
+				Params(Id(argument).Add(typeCode(field.Type()))).
 				Params().
 				Block(
 					Id(receiver).Op(".").Id(field.Name()).Op("=").Id(argument),
@@ -222,17 +567,102 @@ func (st PkgStruct) DefineAccessors(file *File) {
 				Line()
 		}
 	}
+
+	return nil
+}
+
+func (st PkgStruct) filterOpenedFields() []Field {
+	return st.fields
+}
+
+// builderFields is filterOpenedFields without the fields tagged `build:"-"`,
+// which get no builder state at all.
+func (st PkgStruct) builderFields() (fields []Field) {
+	for _, field := range st.filterOpenedFields() {
+		if field.opts.Skip {
+			continue
+		}
+
+		fields = append(fields, field)
+	}
+
+	return
 }
 
-func (st PkgStruct) filterOpenedFields() (fields []Field) {
-	for i := 0; i < st.meta.NumFields(); i++ {
-		field := st.meta.Field(i)
-		if field.Name() == strings.Title(field.Name()) {
+func parseOpenedFields(fset *token.FileSet, pkg *types.Package, meta *types.Struct, exported bool, naming Naming) (fields []Field, err error) {
+	for i := 0; i < meta.NumFields(); i++ {
+		field := meta.Field(i)
+		// clone and equal render every field, whether opened or not
+		if !resolved(field.Type()) {
+			err = fmt.Errorf("%s: field %s has an unresolved type", fset.Position(field.Pos()), field.Name())
+			return
+		}
+		if field.Name() == strings.Title(field.Name()) && !field.Embedded() && !(exported && field.Exported()) {
 			continue
 		}
 
-		fields = append(fields, Field{st.meta.Tag(i), field})
+		opts, parseErr := parseFieldOptions(meta.Tag(i))
+		if parseErr != nil {
+			err = fmt.Errorf("%s: invalid tag of %s: %v", fset.Position(field.Pos()), field.Name(), parseErr)
+			return
+		}
+
+		if opts.Singular != "" && !isCollection(field.Type()) {
+			err = fmt.Errorf("%s: invalid tag of %s: %q applies only to slice and map fields",
+				fset.Position(field.Pos()), field.Name(), SINGULAR_OPTION)
+			return
+		}
+
+		if opts.Flatten {
+			flattened, flattenErr := flattenEmbedded(fset, pkg, meta, field, fields, exported, naming)
+			if flattenErr != nil {
+				err = flattenErr
+				return
+			}
+			fields = append(fields, flattened...)
+			continue
+		}
+
+		fields = append(fields, Field{tag: meta.Tag(i), opts: opts, Var: field, naming: naming})
+	}
+
+	states := make(map[string]Field, len(fields))
+	for _, field := range fields {
+		if other, found := states[field.stateName()]; found {
+			err = fmt.Errorf("%s: %s and %s would share the builder field %s",
+				fset.Position(field.Pos()), other.Name(), field.Name(), field.stateName())
+			return
+		}
+		states[field.stateName()] = field
+	}
+
+	// the builder tracks required fields in a field of its own
+	if field, found := states[ASSIGNED_FIELD]; found {
+		for _, required := range fields {
+			if required.opts.Required && !required.opts.Skip {
+				err = fmt.Errorf("%s: %s would share the builder field %s tracking the required fields",
+					fset.Position(field.Pos()), field.Name(), ASSIGNED_FIELD)
+				return
+			}
+		}
 	}
 
 	return
 }
+
+// lowerInitial lowers the leading capitals of name, keeping the last one of a
+// run followed by lower case, e.g. "URLPath" becomes "urlPath".
+func lowerInitial(name string) string {
+	runes := []rune(name)
+	for i := range runes {
+		if !unicode.IsUpper(runes[i]) {
+			break
+		}
+		if 0 < i && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(runes[i])
+	}
+
+	return string(runes)
+}
@@ -0,0 +1,100 @@
+package builder
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+// checkSource type-checks src as the single file of a package.
+func checkSource(t *testing.T, src string) (*token.FileSet, *types.Package) {
+	t.Helper()
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "entity.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := conf.Check("example.com/entity", fset, []*ast.File{file}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fset, pkg
+}
+
+func TestParseOpenedFieldsReservesAssigned(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		wantErr string
+	}{
+		{
+			name: "without required fields",
+			src:  "package entity\n\ntype Task struct {\n\tid       string\n\tassigned string\n}\n",
+		},
+		{
+			name:    "with required fields",
+			src:     "package entity\n\ntype Task struct {\n\tid       string `build:\",required\"`\n\tassigned string\n}\n",
+			wantErr: "entity.go:5:2: assigned would share the builder field assigned",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fset, pkg := checkSource(t, tt.src)
+			meta := pkg.Scope().Lookup("Task").Type().Underlying().(*types.Struct)
+
+			_, err := parseOpenedFields(fset, pkg, meta, false, NewIdiomaticNaming())
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("parseOpenedFields() = %v, want no error", err)
+			case tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)):
+				t.Errorf("parseOpenedFields() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseOpenedFieldsRejectsUnresolvedTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		field   string
+		wantErr string
+	}{
+		{"undefined", "when Missing", "entity.go:4:2: field when has an unresolved type"},
+		{"element", "whens []*Missing", "entity.go:4:2: field whens has an unresolved type"},
+		{"map value", "byName map[string]Missing", "entity.go:4:2: field byName has an unresolved type"},
+		{"type argument", "list List[Missing]", "entity.go:4:2: field list has an unresolved type"},
+		{"exported", "When Missing", "entity.go:4:2: field When has an unresolved type"},
+		{"resolved", "when []List[int]", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := "package entity\n\ntype Task struct {\n\t" + tt.field + "\n}\n\ntype List[T any] []T\n"
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, "entity.go", src, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the undefined names are type errors the package is checked despite
+			conf := types.Config{Error: func(error) {}}
+			pkg, _ := conf.Check("example.com/entity", fset, []*ast.File{file}, nil)
+			meta := pkg.Scope().Lookup("Task").Type().Underlying().(*types.Struct)
+
+			_, err = parseOpenedFields(fset, pkg, meta, false, NewIdiomaticNaming())
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("parseOpenedFields() = %v, want no error", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Errorf("parseOpenedFields() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package builder
+
+import (
+	"fmt"
+	"go/token"
+	"reflect"
+	"strings"
+)
+
+const (
+	SKIP_OPTION     = "-"
+	OMIT_OPTION     = "omit"
+	DEFAULT_OPTION  = "default="
+	SINGULAR_OPTION = "singular="
+	FLATTEN_OPTION  = "flatten"
+)
+
+// FieldOptions is the parsed form of a `build` tag:
+//
+//	build:"-"                    no builder state at all
+//	build:"Name"                 custom setter name
+//	build:",required"            must be set before Build
+//	build:",omit"                builder state without a setter
+//	build:",singular=Name"       element name of the collection helpers
+//	build:",flatten"             setters for the fields of an embedded struct
+//	build:",default=expr"        same as the default tag; must come last
+type FieldOptions struct {
+	Skip       bool
+	Name       string
+	Required   bool
+	Omit       bool
+	Singular   string
+	Flatten    bool
+	Default    string
+	HasDefault bool
+}
+
+func parseFieldOptions(tag string) (opts FieldOptions, err error) {
+	build, found := reflect.StructTag(tag).Lookup(BUILD_TAG_VALUE)
+	if expr, ok := reflect.StructTag(tag).Lookup(DEFAULT_TAG_VALUE); ok {
+		opts.Default = expr
+		opts.HasDefault = true
+	}
+	if !found {
+		return
+	}
+
+	name, rest, _ := strings.Cut(build, ",")
+	name = strings.TrimSpace(name)
+	switch {
+	case name == SKIP_OPTION:
+		if rest != "" {
+			err = fmt.Errorf("%q takes no options", SKIP_OPTION)
+			return
+		}
+		if opts.HasDefault {
+			err = fmt.Errorf("default has no effect on a %q field", SKIP_OPTION)
+			return
+		}
+		opts.Skip = true
+		return
+	case name != "" && !token.IsIdentifier(name):
+		err = fmt.Errorf("%q is not a valid method name", name)
+		return
+	}
+	opts.Name = name
+
+	for rest != "" {
+		var option string
+		option, rest, _ = strings.Cut(rest, ",")
+		option = strings.TrimSpace(option)
+
+		switch {
+		case option == REQUIRED_OPTION:
+			opts.Required = true
+		case option == OMIT_OPTION:
+			opts.Omit = true
+		case option == FLATTEN_OPTION:
+			opts.Flatten = true
+		case strings.HasPrefix(option, SINGULAR_OPTION):
+			opts.Singular = strings.TrimPrefix(option, SINGULAR_OPTION)
+			if !token.IsIdentifier(opts.Singular) {
+				err = fmt.Errorf("%q is not a valid singular name", opts.Singular)
+				return
+			}
+		case strings.HasPrefix(option, DEFAULT_OPTION):
+			if opts.HasDefault {
+				err = fmt.Errorf("default is given twice")
+				return
+			}
+			// the expression may contain commas itself, so it takes the rest
+			opts.Default = strings.TrimPrefix(option, DEFAULT_OPTION)
+			if rest != "" {
+				opts.Default += "," + rest
+			}
+			opts.HasDefault = true
+			rest = ""
+		case option == "":
+			err = fmt.Errorf("empty option")
+			return
+		default:
+			err = fmt.Errorf("unknown option %q", option)
+			return
+		}
+	}
+
+	if opts.Required && opts.Omit {
+		err = fmt.Errorf("%q field can never be set, drop %q", REQUIRED_OPTION, OMIT_OPTION)
+		return
+	}
+	if opts.Required && opts.HasDefault {
+		err = fmt.Errorf("%q field has to be set despite its default, drop one of them", REQUIRED_OPTION)
+		return
+	}
+	if opts.Flatten && (opts.Name != "" || opts.Required || opts.Omit || opts.Singular != "" || opts.HasDefault) {
+		err = fmt.Errorf("%q takes no other options", FLATTEN_OPTION)
+	}
+
+	return
+}
@@ -0,0 +1,59 @@
+package builder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFieldOptions(t *testing.T) {
+	tests := []struct {
+		tag     string
+		want    FieldOptions
+		wantErr bool
+	}{
+		{tag: ``, want: FieldOptions{}},
+		{tag: `json:"id"`, want: FieldOptions{}},
+		{tag: `build:""`, want: FieldOptions{}},
+		{tag: `build:"-"`, want: FieldOptions{Skip: true}},
+		{tag: `build:"ID"`, want: FieldOptions{Name: "ID"}},
+		{tag: `build:"ID,required"`, want: FieldOptions{Name: "ID", Required: true}},
+		{tag: `build:", omit"`, want: FieldOptions{Omit: true}},
+		{tag: `build:",singular=person"`, want: FieldOptions{Singular: "person"}},
+		{tag: `build:",flatten"`, want: FieldOptions{Flatten: true}},
+		{tag: `build:",default=3"`, want: FieldOptions{Default: "3", HasDefault: true}},
+		{tag: `build:",default=[]int{1, 2}"`, want: FieldOptions{Default: "[]int{1, 2}", HasDefault: true}},
+		{tag: `build:",omit,default=f(a, b)"`, want: FieldOptions{Omit: true, Default: "f(a, b)", HasDefault: true}},
+		{tag: `default:"StatusActive"`, want: FieldOptions{Default: "StatusActive", HasDefault: true}},
+		{tag: `build:"Name" default:"x"`, want: FieldOptions{Name: "Name", Default: "x", HasDefault: true}},
+
+		{tag: `build:"-,required"`, wantErr: true},
+		{tag: `build:"-" default:"1"`, wantErr: true},
+		{tag: `build:"set-name"`, wantErr: true},
+		{tag: `build:",requird"`, wantErr: true},
+		{tag: `build:",,required"`, wantErr: true},
+		{tag: `build:",singular=two words"`, wantErr: true},
+		{tag: `build:",default=1" default:"2"`, wantErr: true},
+		{tag: `build:",required,omit"`, wantErr: true},
+		{tag: `build:",required,default=3"`, wantErr: true},
+		{tag: `build:",required" default:"3"`, wantErr: true},
+		{tag: `build:",flatten,required"`, wantErr: true},
+		{tag: `build:"Name,flatten"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseFieldOptions(tt.tag)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseFieldOptions(%q) = %+v, want an error", tt.tag, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseFieldOptions(%q) fails: %v", tt.tag, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseFieldOptions(%q) = %+v, want %+v", tt.tag, got, tt.want)
+		}
+	}
+}
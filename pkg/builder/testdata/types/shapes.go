@@ -0,0 +1,45 @@
+package shapes
+
+import (
+	"io"
+	"time"
+	"unsafe"
+)
+
+type Local int
+
+type Box[T any] struct {
+	value T
+}
+
+// Shapes holds a field of every type shape typeCode renders.
+type Shapes struct {
+	qualified  time.Time
+	local      Local
+	pointer    *time.Time
+	slice      []*Local
+	array      [4]byte
+	mapped     map[string]io.Reader
+	both       chan int
+	send       chan<- int
+	recv       <-chan int
+	chanOfRecv chan (<-chan int)
+	sendOfRecv chan<- <-chan int
+	recvOfSend <-chan chan<- int
+	variadic   func(format string, args ...interface{}) (n int, err error)
+	callback   func(int) error
+	anonymous  struct {
+		id   int    `json:"id"`
+		name string `json:"name,omitempty" db:"name"`
+	}
+	iface interface {
+		io.Reader
+		Close() error
+	}
+	generic   Box[time.Duration]
+	unsafePtr unsafe.Pointer
+}
+
+type Number interface {
+	~int | ~float64 | string
+}
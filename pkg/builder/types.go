@@ -0,0 +1,273 @@
+package builder
+
+import (
+	"go/types"
+	"strconv"
+	"strings"
+
+	. "github.com/dave/jennifer/jen"
+)
+
+// typeCode renders t as jennifer code. named types are emitted with Qual,
+// so the generated file imports whatever package they come from.
+func typeCode(t types.Type) Code {
+	switch t := t.(type) {
+	case *types.Basic:
+		if t.Kind() == types.UnsafePointer {
+			return Qual("unsafe", "Pointer")
+		}
+		return Id(t.Name())
+	case *types.Named:
+		return objectCode(t.Obj()).Types(typeListCode(t.TypeArgs())...)
+	case *types.Alias:
+		return objectCode(t.Obj())
+	case *types.Pointer:
+		return Op("*").Add(typeCode(t.Elem()))
+	case *types.Slice:
+		return Index().Add(typeCode(t.Elem()))
+	case *types.Array:
+		return Index(Lit(int(t.Len()))).Add(typeCode(t.Elem()))
+	case *types.Map:
+		return Map(typeCode(t.Key())).Add(typeCode(t.Elem()))
+	case *types.Chan:
+		return chanCode(t)
+	case *types.Signature:
+		return Func().Add(signatureCode(t))
+	case *types.Struct:
+		return structCode(t)
+	case *types.Interface:
+		return interfaceCode(t)
+	case *types.TypeParam:
+		return Id(t.Obj().Name())
+	case *types.Union:
+		return unionCode(t)
+	}
+
+	return Id(t.String())
+}
+
+// resolved reports whether t was fully type-checked. a type the checker could
+// not resolve, such as an undefined name, is invalid and cannot be rendered.
+func resolved(t types.Type) bool {
+	switch t := t.(type) {
+	case *types.Basic:
+		return t.Kind() != types.Invalid
+	case *types.Named:
+		for i := 0; i < t.TypeArgs().Len(); i++ {
+			if !resolved(t.TypeArgs().At(i)) {
+				return false
+			}
+		}
+	case *types.Pointer:
+		return resolved(t.Elem())
+	case *types.Slice:
+		return resolved(t.Elem())
+	case *types.Array:
+		return resolved(t.Elem())
+	case *types.Map:
+		return resolved(t.Key()) && resolved(t.Elem())
+	case *types.Chan:
+		return resolved(t.Elem())
+	case *types.Signature:
+		return resolved(t.Params()) && resolved(t.Results())
+	case *types.Tuple:
+		for i := 0; i < t.Len(); i++ {
+			if !resolved(t.At(i).Type()) {
+				return false
+			}
+		}
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if !resolved(t.Field(i).Type()) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func objectCode(obj *types.TypeName) *Statement {
+	if obj.Pkg() == nil {
+		return Id(obj.Name())
+	}
+
+	return Qual(obj.Pkg().Path(), obj.Name())
+}
+
+func typeListCode(list *types.TypeList) []Code {
+	codes := make([]Code, 0, list.Len())
+	for i := 0; i < list.Len(); i++ {
+		codes = append(codes, typeCode(list.At(i)))
+	}
+
+	return codes
+}
+
+// typeParamsCode renders a type parameter list with its constraints, as used
+// in type and function declarations.
+func typeParamsCode(params *types.TypeParamList) []Code {
+	codes := make([]Code, 0, params.Len())
+	for i := 0; i < params.Len(); i++ {
+		param := params.At(i)
+		codes = append(codes, Id(param.Obj().Name()).Add(constraintCode(param.Constraint())))
+	}
+
+	return codes
+}
+
+// typeArgsCode renders the bare type parameter names, as used in receivers
+// and instantiations.
+func typeArgsCode(params *types.TypeParamList) []Code {
+	codes := make([]Code, 0, params.Len())
+	for i := 0; i < params.Len(); i++ {
+		codes = append(codes, Id(params.At(i).Obj().Name()))
+	}
+
+	return codes
+}
+
+func constraintCode(t types.Type) Code {
+	iface, ok := t.(*types.Interface)
+	if !ok {
+		return typeCode(t)
+	}
+
+	// [T ~int | ~string] is an implicit interface around its union
+	if iface.IsImplicit() && iface.NumEmbeddeds() == 1 {
+		return typeCode(iface.EmbeddedType(0))
+	}
+	if iface.Empty() {
+		return Id("any")
+	}
+
+	return typeCode(iface)
+}
+
+func unionCode(t *types.Union) Code {
+	terms := make([]Code, 0, t.Len())
+	for i := 0; i < t.Len(); i++ {
+		term := t.Term(i)
+		if term.Tilde() {
+			terms = append(terms, Op("~").Add(typeCode(term.Type())))
+			continue
+		}
+		terms = append(terms, typeCode(term.Type()))
+	}
+
+	return Union(terms...)
+}
+
+func chanCode(t *types.Chan) Code {
+	elem := typeCode(t.Elem())
+	switch t.Dir() {
+	case types.SendOnly:
+		return Chan().Op("<-").Add(elem)
+	case types.RecvOnly:
+		return Op("<-").Chan().Add(elem)
+	}
+
+	// "chan <-chan T" would be read as "chan<- chan T"
+	if inner, ok := t.Elem().(*types.Chan); ok && inner.Dir() == types.RecvOnly {
+		return Chan().Parens(elem)
+	}
+
+	return Chan().Add(elem)
+}
+
+func signatureCode(sig *types.Signature) *Statement {
+	params := make([]Code, 0, sig.Params().Len())
+	for i := 0; i < sig.Params().Len(); i++ {
+		param := sig.Params().At(i)
+		paramType := typeCode(param.Type())
+		if sig.Variadic() && i == sig.Params().Len()-1 {
+			paramType = Op("...").Add(typeCode(param.Type().(*types.Slice).Elem()))
+		}
+		params = append(params, Id(param.Name()).Add(paramType))
+	}
+
+	results := make([]Code, 0, sig.Results().Len())
+	for i := 0; i < sig.Results().Len(); i++ {
+		result := sig.Results().At(i)
+		results = append(results, Id(result.Name()).Add(typeCode(result.Type())))
+	}
+
+	stmt := Params(params...)
+	switch {
+	case len(results) == 1 && sig.Results().At(0).Name() == "":
+		stmt.Add(results[0])
+	case 0 < len(results):
+		stmt.Params(results...)
+	}
+
+	return stmt
+}
+
+func structCode(t *types.Struct) Code {
+	fields := make([]Code, 0, t.NumFields())
+	for i := 0; i < t.NumFields(); i++ {
+		field := t.Field(i)
+		var code *Statement
+		if field.Embedded() {
+			code = Add(typeCode(field.Type()))
+		} else {
+			code = Id(field.Name()).Add(typeCode(field.Type()))
+		}
+		if tags := structTagMap(t.Tag(i)); 0 < len(tags) {
+			code.Tag(tags)
+		}
+		fields = append(fields, code)
+	}
+
+	return Struct(fields...)
+}
+
+func interfaceCode(t *types.Interface) Code {
+	methods := make([]Code, 0, t.NumEmbeddeds()+t.NumExplicitMethods())
+	for i := 0; i < t.NumEmbeddeds(); i++ {
+		methods = append(methods, typeCode(t.EmbeddedType(i)))
+	}
+	for i := 0; i < t.NumExplicitMethods(); i++ {
+		method := t.ExplicitMethod(i)
+		methods = append(methods, Id(method.Name()).Add(signatureCode(method.Type().(*types.Signature))))
+	}
+
+	return Interface(methods...)
+}
+
+// structTagMap splits a conventional `key:"value"` struct tag into the map
+// form jennifer expects, scanning it the same way reflect.StructTag does.
+func structTagMap(tag string) map[string]string {
+	tags := make(map[string]string)
+	for tag != "" {
+		tag = strings.TrimLeft(tag, " ")
+		i := 0
+		for i < len(tag) && tag[i] > ' ' && tag[i] != ':' && tag[i] != '"' && tag[i] != 0x7f {
+			i++
+		}
+		if i == 0 || len(tag) <= i+1 || tag[i] != ':' || tag[i+1] != '"' {
+			break
+		}
+		name := tag[:i]
+		tag = tag[i+1:]
+
+		i = 1
+		for i < len(tag) && tag[i] != '"' {
+			if tag[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if len(tag) <= i {
+			break
+		}
+		value, err := strconv.Unquote(tag[:i+1])
+		if err != nil {
+			break
+		}
+		tags[name] = value
+		tag = tag[i+1:]
+	}
+
+	return tags
+}
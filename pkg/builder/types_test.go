@@ -0,0 +1,55 @@
+package builder
+
+import (
+	"bytes"
+	"flag"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/dave/jennifer/jen"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+func TestTypeCode(t *testing.T) {
+	fset := token.NewFileSet()
+	src := filepath.Join("testdata", "types", "shapes.go")
+	file, err := parser.ParseFile(fset, src, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := conf.Check("example.com/shapes", fset, []*ast.File{file}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := NewFilePathName(pkg.Path(), pkg.Name())
+	for _, name := range []string{"Shapes", "Number"} {
+		f.Type().Id(name).Add(typeCode(pkg.Scope().Lookup(name).Type().Underlying()))
+	}
+	buf := &bytes.Buffer{}
+	if err := f.Render(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", "types", "shapes.golden")
+	if *update {
+		if err := os.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != string(want) {
+		t.Errorf("typeCode rendered\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,170 @@
+package fileoperator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DIFF_CONTEXT is the number of unchanged lines shown around each change.
+const DIFF_CONTEXT = 3
+
+type edit struct {
+	op   byte
+	line string
+}
+
+// UnifiedDiff renders the changes from before to after in the unified format,
+// labeling both sides with name, or /dev/null for a side that is empty as the
+// file is created or removed. it is empty when nothing changed.
+func UnifiedDiff(name string, before string, after string) string {
+	if before == after {
+		return ""
+	}
+
+	edits := diffLines(splitLines(before), splitLines(after))
+
+	// line numbers of both sides in front of each edit
+	oldLines := make([]int, len(edits)+1)
+	newLines := make([]int, len(edits)+1)
+	for k, e := range edits {
+		oldLines[k+1], newLines[k+1] = oldLines[k], newLines[k]
+		if e.op != '+' {
+			oldLines[k+1]++
+		}
+		if e.op != '-' {
+			newLines[k+1]++
+		}
+	}
+
+	buf := &strings.Builder{}
+	oldName, newName := name, name
+	if before == "" {
+		oldName = "/dev/null"
+	}
+	if after == "" {
+		newName = "/dev/null"
+	}
+	fmt.Fprintf(buf, "--- %s\n+++ %s\n", oldName, newName)
+
+	for i := 0; i < len(edits); {
+		for i < len(edits) && edits[i].op == ' ' {
+			i++
+		}
+		if len(edits) <= i {
+			break
+		}
+
+		// changes closer than twice the context share a hunk
+		end := i
+		for end < len(edits) {
+			if edits[end].op != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(edits) && edits[run].op == ' ' {
+				run++
+			}
+			if run == len(edits) || 2*DIFF_CONTEXT < run-end {
+				break
+			}
+			end = run
+		}
+
+		start := max(i-DIFF_CONTEXT, 0)
+		stop := min(end+DIFF_CONTEXT, len(edits))
+		fmt.Fprintf(buf, "@@ -%s +%s @@\n",
+			hunkRange(oldLines[start], oldLines[stop]-oldLines[start]),
+			hunkRange(newLines[start], newLines[stop]-newLines[start]))
+		for _, e := range edits[start:stop] {
+			buf.WriteByte(e.op)
+			buf.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		i = end
+	}
+
+	return buf.String()
+}
+
+func hunkRange(start int, count int) string {
+	if count <= 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// splitLines splits text into lines which keep their line break.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// diffLines turns a into b through the longest common subsequence of their
+// lines, deleting and inserting the others.
+func diffLines(a []string, b []string) []edit {
+	// the common prefix and suffix need no table
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	x, y := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:]
+	lcs := make([][]int32, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(y)+1)
+	}
+	for i := len(x) - 1; 0 <= i; i-- {
+		for j := len(y) - 1; 0 <= j; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	edits := make([]edit, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		edits = append(edits, edit{' ', line})
+	}
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			edits = append(edits, edit{' ', x[i]})
+			i++
+			j++
+		case lcs[i][j+1] <= lcs[i+1][j]:
+			edits = append(edits, edit{'-', x[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		edits = append(edits, edit{'-', x[i]})
+	}
+	for ; j < len(y); j++ {
+		edits = append(edits, edit{'+', y[j]})
+	}
+	for _, line := range a[len(a)-suffix:] {
+		edits = append(edits, edit{' ', line})
+	}
+
+	return edits
+}
@@ -0,0 +1,129 @@
+package fileoperator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func lines(n int) string {
+	buf := &strings.Builder{}
+	for i := 1; i <= n; i++ {
+		buf.WriteString(string(rune('a'+i-1)) + "\n")
+	}
+
+	return buf.String()
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		after  string
+		want   string
+	}{
+		{
+			name:   "unchanged",
+			before: "a\nb\n",
+			after:  "a\nb\n",
+			want:   "",
+		},
+		{
+			name:   "created",
+			before: "",
+			after:  "a\nb\n",
+			want:   "--- /dev/null\n+++ f.go\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:   "removed",
+			before: "a\nb\n",
+			after:  "",
+			want:   "--- f.go\n+++ /dev/null\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name:   "changed in the middle",
+			before: lines(9),
+			after:  strings.Replace(lines(9), "e\n", "E\n", 1),
+			want:   "--- f.go\n+++ f.go\n@@ -2,7 +2,7 @@\n b\n c\n d\n-e\n+E\n f\n g\n h\n",
+		},
+		{
+			name:   "distant changes",
+			before: lines(12),
+			after:  strings.Replace(strings.Replace(lines(12), "a\n", "A\n", 1), "l\n", "L\n", 1),
+			want: "--- f.go\n+++ f.go\n@@ -1,4 +1,4 @@\n-a\n+A\n b\n c\n d\n" +
+				"@@ -9,4 +9,4 @@\n i\n j\n k\n-l\n+L\n",
+		},
+		{
+			name:   "close changes",
+			before: lines(8),
+			after:  strings.Replace(strings.Replace(lines(8), "a\n", "A\n", 1), "h\n", "H\n", 1),
+			want:   "--- f.go\n+++ f.go\n@@ -1,8 +1,8 @@\n-a\n+A\n b\n c\n d\n e\n f\n g\n-h\n+H\n",
+		},
+		{
+			name:   "no newline at end of file",
+			before: "a\nb",
+			after:  "a\nb\n",
+			want:   "--- f.go\n+++ f.go\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UnifiedDiff("f.go", tt.before, tt.after); got != tt.want {
+				t.Errorf("UnifiedDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a    []string
+		b    []string
+		want []edit
+	}{
+		{
+			name: "empty",
+			want: []edit{},
+		},
+		{
+			name: "equal",
+			a:    []string{"a", "b"},
+			b:    []string{"a", "b"},
+			want: []edit{{' ', "a"}, {' ', "b"}},
+		},
+		{
+			name: "inserted",
+			a:    []string{"a", "c"},
+			b:    []string{"a", "b", "c"},
+			want: []edit{{' ', "a"}, {'+', "b"}, {' ', "c"}},
+		},
+		{
+			name: "deleted",
+			a:    []string{"a", "b", "c"},
+			b:    []string{"a", "c"},
+			want: []edit{{' ', "a"}, {'-', "b"}, {' ', "c"}},
+		},
+		{
+			name: "replaced",
+			a:    []string{"a", "b", "c"},
+			b:    []string{"a", "x", "c"},
+			want: []edit{{' ', "a"}, {'-', "b"}, {'+', "x"}, {' ', "c"}},
+		},
+		{
+			name: "common subsequence",
+			a:    []string{"a", "b", "c", "d"},
+			b:    []string{"b", "d", "e"},
+			want: []edit{{'-', "a"}, {' ', "b"}, {'-', "c"}, {' ', "d"}, {'+', "e"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffLines(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,106 +1,380 @@
 package fileoperator
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/arabian9ts/builder/pkg/builder"
 )
 
-func filterBuilderFile(info os.FileInfo) bool {
-	if info.IsDir() {
-		return false
+const (
+	BUILDER_KIND  = "builder"
+	ACCESSOR_KIND = "accessor"
+	OPTIONS_KIND  = "options"
+)
+
+// KINDS are the kinds of generated files, in the order they are generated.
+var KINDS = []string{BUILDER_KIND, ACCESSOR_KIND, OPTIONS_KIND}
+
+// GeneratedFile is the code of one kind generated for one source file.
+type GeneratedFile struct {
+	Kind   string
+	Source string
+	Path   string
+	Code   string
+}
+
+const (
+	STALE_CHANGED  = "changed"
+	STALE_MISSING  = "missing"
+	STALE_ORPHANED = "orphaned"
+)
+
+// StaleFile is a generated file which is out of date with its source.
+type StaleFile struct {
+	Path string
+	// Reason is STALE_CHANGED when the file would be rewritten, STALE_MISSING
+	// when it would be created and STALE_ORPHANED when it is no longer
+	// generated, as when its source is gone.
+	Reason string
+}
+
+// Listing describes what is generated for one source file.
+type Listing struct {
+	PkgPath   string
+	Source    string
+	Structs   []string
+	Generated []string
+}
+
+// isGeneratedFile tells generated files by their header rather than by their
+// name, so that hand-written files such as query_builder.go stay input.
+func isGeneratedFile(fileName string) (bool, error) {
+	_, generated, err := builder.GeneratedFrom(fileName)
+	return generated, err
+}
+
+// kindOf tells the kind of a generated file from its name.
+func kindOf(fileName string) string {
+	for _, kind := range KINDS {
+		if strings.HasSuffix(fileName, fmt.Sprintf("_%s.go", kind)) {
+			return kind
+		}
 	}
 
-	if idx := strings.Index(info.Name(), "_builder"); 0 < idx {
-		return false
+	return ""
+}
+
+func filterBuilderFile(fileName string) (bool, error) {
+	generated, err := isGeneratedFile(fileName)
+	return !generated, err
+}
+
+func filterNonBuilderFile(fileName string) (bool, error) {
+	return isGeneratedFile(fileName)
+}
+
+func generatedFileName(source string, kind string) string {
+	pos := strings.LastIndex(source, ".")
+	return fmt.Sprintf("%s_%s.go", source[:pos], kind)
+}
+
+func generate(file builder.PkgFile, kind string) (string, error) {
+	switch kind {
+	case BUILDER_KIND:
+		return file.GenerateBuilder()
+	case ACCESSOR_KIND:
+		return file.GenerateAccessor()
+	case OPTIONS_KIND:
+		return file.GenerateOptions()
 	}
 
-	if idx := strings.Index(info.Name(), "_accessor"); 0 < idx {
-		return false
+	return "", fmt.Errorf("unknown kind %q", kind)
+}
+
+// Render generates the files of kinds for pkg without writing them. the errors
+// of every file are reported together, each once although every kind comes
+// across the errors of parsing the structs.
+func Render(pkg *builder.Package, kinds []string, conf builder.Config) ([]GeneratedFile, error) {
+	files := pkg.ParsePkgFiles(conf)
+
+	generated := make([]GeneratedFile, 0, len(files)*len(kinds))
+	var errs []error
+	reported := make(map[string]bool)
+	for _, kind := range kinds {
+		for _, file := range files {
+			code, err := generate(file, kind)
+			if err != nil {
+				if !reported[err.Error()] {
+					reported[err.Error()] = true
+					errs = append(errs, err)
+				}
+				continue
+			}
+			// nothing to write, as for files without options
+			if code == "" {
+				continue
+			}
+
+			generated = append(generated, GeneratedFile{
+				Kind:   kind,
+				Source: file.FileName,
+				Path:   generatedFileName(file.FileName, kind),
+				Code:   code,
+			})
+		}
 	}
 
-	return true
+	return generated, errors.Join(errs...)
 }
 
-func filterNonBuilderFile(info os.FileInfo) bool {
-	if info.IsDir() {
-		return false
+// orphanedFiles lists the generated files of kinds in pkg which the
+// generation no longer produces, such as those whose source file is gone.
+func orphanedFiles(pkg *builder.Package, kinds []string, generated []GeneratedFile) []string {
+	produced := make(map[string]bool, len(generated))
+	for _, file := range generated {
+		produced[file.Path] = true
 	}
 
-	if idx := strings.Index(info.Name(), "_builder"); 0 < idx {
-		return true
+	orphaned := make([]string, 0)
+	for _, fileName := range pkg.ExcludedFiles() {
+		if contains(kinds, kindOf(fileName)) && !produced[fileName] {
+			orphaned = append(orphaned, fileName)
+		}
 	}
 
-	if idx := strings.Index(info.Name(), "_accessor"); 0 < idx {
-		return true
+	return orphaned
+}
+
+// Generate writes the files of kinds for every package matched by targetPkgs
+// and removes the orphaned ones. it returns the paths of the files written,
+// leaving out those whose content did not change, and of the files removed.
+// a package failing to generate is left untouched, while the others are
+// still written.
+func Generate(targetPkgs []string, kinds []string, conf builder.Config) ([]string, []string, error) {
+	pkgs, err := builder.LoadPackages(targetPkgs, filterBuilderFile)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return false
+	written := make([]string, 0)
+	removed := make([]string, 0)
+	var errs []error
+	for _, pkg := range pkgs {
+		files, err := Render(pkg, kinds, conf)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		orphaned := orphanedFiles(pkg, kinds, files)
+		files, err = writePackage(files, orphaned)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, file := range files {
+			written = append(written, file.Path)
+		}
+		removed = append(removed, orphaned...)
+	}
+
+	return written, removed, errors.Join(errs...)
 }
 
-func CleanBuilder(targetPkg string) error {
-	pkg, err := builder.LoadPackage(targetPkg, filterNonBuilderFile)
+// Diff runs the generation of every package matched by targetPkgs like
+// Generate, but returns unified diffs of the files against their contents on
+// disk instead of writing them.
+func Diff(targetPkgs []string, kinds []string, conf builder.Config) ([]string, error) {
+	pkgs, err := builder.LoadPackages(targetPkgs, filterBuilderFile)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	files := pkg.ParsePkgFiles()
-	for _, file := range files {
-		pos := strings.LastIndex(file.FileName, ".")
-		fileName := fmt.Sprintf("%s.go", file.FileName[:pos])
-		err := os.Remove(fileName)
+	diffs := make([]string, 0)
+	var errs []error
+	for _, pkg := range pkgs {
+		files, err := Render(pkg, kinds, conf)
 		if err != nil {
-			return err
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, file := range files {
+			current, err := os.ReadFile(file.Path)
+			if err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+				continue
+			}
+
+			if builder.SameGenerated(string(current), file.Code) {
+				continue
+			}
+			if diff := UnifiedDiff(displayName(file.Path), string(current), file.Code); diff != "" {
+				diffs = append(diffs, diff)
+			}
+		}
+
+		for _, fileName := range orphanedFiles(pkg, kinds, files) {
+			current, err := os.ReadFile(fileName)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			diffs = append(diffs, UnifiedDiff(displayName(fileName), string(current), ""))
 		}
 	}
 
-	return nil
+	return diffs, errors.Join(errs...)
 }
 
-func CreateBuilder(targetPkg string) error {
-	pkg, err := builder.LoadPackage(targetPkg, filterBuilderFile)
+// displayName shortens fileName to a path relative to the working directory
+// when it is below it.
+func displayName(fileName string) string {
+	wd, err := os.Getwd()
 	if err != nil {
-		return err
+		return fileName
+	}
+	rel, err := filepath.Rel(wd, fileName)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return fileName
 	}
 
-	files := pkg.ParsePkgFiles()
-	for _, file := range files {
-		pos := strings.LastIndex(file.FileName, ".")
-		fileName := fmt.Sprintf("%s_builder.go", file.FileName[:pos])
-		fp, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE, 0755)
+	return filepath.ToSlash(rel)
+}
+
+// CreateBuilder writes the builder files of every package matched by targetPkgs.
+func CreateBuilder(targetPkgs []string, conf builder.Config) error {
+	_, _, err := Generate(targetPkgs, []string{BUILDER_KIND}, conf)
+	return err
+}
+
+// CreateAccessor writes the accessor files of every package matched by targetPkgs.
+func CreateAccessor(targetPkgs []string, conf builder.Config) error {
+	_, _, err := Generate(targetPkgs, []string{ACCESSOR_KIND}, conf)
+	return err
+}
+
+// CreateOptions writes the options files of every package matched by targetPkgs.
+func CreateOptions(targetPkgs []string, conf builder.Config) error {
+	_, _, err := Generate(targetPkgs, []string{OPTIONS_KIND}, conf)
+	return err
+}
+
+// Check runs the generation of every package matched by targetPkgs in memory
+// and compares the result with the files on disk, without writing anything.
+// it returns the generated files that are out of date.
+func Check(targetPkgs []string, kinds []string, conf builder.Config) ([]StaleFile, error) {
+	pkgs, err := builder.LoadPackages(targetPkgs, filterBuilderFile)
+	if err != nil {
+		return nil, err
+	}
+
+	stale := make([]StaleFile, 0)
+	var errs []error
+	for _, pkg := range pkgs {
+		files, err := Render(pkg, kinds, conf)
 		if err != nil {
-			return err
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, file := range files {
+			current, err := os.ReadFile(file.Path)
+			switch {
+			case os.IsNotExist(err):
+				stale = append(stale, StaleFile{Path: file.Path, Reason: STALE_MISSING})
+			case err != nil:
+				errs = append(errs, err)
+			case !builder.SameGenerated(string(current), file.Code):
+				stale = append(stale, StaleFile{Path: file.Path, Reason: STALE_CHANGED})
+			}
 		}
-		defer fp.Close()
 
-		code := file.GenerateBuilder()
-		fp.WriteString(code)
+		for _, fileName := range orphanedFiles(pkg, kinds, files) {
+			stale = append(stale, StaleFile{Path: fileName, Reason: STALE_ORPHANED})
+		}
 	}
 
-	return nil
+	return stale, errors.Join(errs...)
 }
 
-func CreateAccessor(targetPkg string) error {
-	pkg, err := builder.LoadPackage(targetPkg, filterBuilderFile)
+// List describes the source files of every package matched by targetPkgs,
+// with their structs and the files generated of kinds.
+func List(targetPkgs []string, kinds []string, conf builder.Config) ([]Listing, error) {
+	pkgs, err := builder.LoadPackages(targetPkgs, filterBuilderFile)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	files := pkg.ParsePkgFiles()
-	for _, file := range files {
-		pos := strings.LastIndex(file.FileName, ".")
-		fileName := fmt.Sprintf("%s_accessor.go", file.FileName[:pos])
-		fp, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE, 0755)
+	listings := make([]Listing, 0)
+	var errs []error
+	for _, pkg := range pkgs {
+		generated, err := Render(pkg, kinds, conf)
 		if err != nil {
-			return err
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, file := range pkg.ParsePkgFiles(conf) {
+			structs, err := file.StructNames()
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			listing := Listing{PkgPath: pkg.PkgPath, Source: file.FileName, Structs: structs}
+			for _, g := range generated {
+				if g.Source == file.FileName {
+					listing.Generated = append(listing.Generated, g.Path)
+				}
+			}
+			listings = append(listings, listing)
 		}
-		defer fp.Close()
+	}
+
+	return listings, errors.Join(errs...)
+}
 
-		code := file.GenerateAccessor()
-		fp.WriteString(code)
+// CleanBuilder removes the generated files of kinds from every package matched
+// by targetPkgs and returns their paths.
+func CleanBuilder(targetPkgs []string, kinds []string) ([]string, error) {
+	pkgs, err := builder.LoadPackages(targetPkgs, filterNonBuilderFile)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	removed := make([]string, 0)
+	var errs []error
+	for _, pkg := range pkgs {
+		files := pkg.ParsePkgFiles(builder.Config{})
+		for _, file := range files {
+			if !contains(kinds, kindOf(file.FileName)) {
+				continue
+			}
+
+			pos := strings.LastIndex(file.FileName, ".")
+			fileName := fmt.Sprintf("%s.go", file.FileName[:pos])
+			if err := os.Remove(fileName); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			removed = append(removed, fileName)
+		}
+	}
+
+	return removed, errors.Join(errs...)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
 }
@@ -0,0 +1,151 @@
+package fileoperator
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/arabian9ts/builder/pkg/builder"
+	"golang.org/x/tools/go/packages"
+)
+
+// useFixture copies the module in testdata/shop to a temporary directory and
+// makes it the working directory for the rest of the test.
+func useFixture(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	err := filepath.WalkDir(filepath.Join("testdata", "shop"), func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(filepath.Join("testdata", "shop"), path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(dir, rel), 0755)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, rel), content, 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	// the temporary directory may be reached through a symlink
+	dir, err = os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func TestGenerateCompiles(t *testing.T) {
+	useFixture(t)
+
+	written, removed, err := Generate([]string{"./..."}, KINDS, builder.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) <= 0 || len(removed) != 0 {
+		t.Fatalf("Generate() wrote %q and removed %q", written, removed)
+	}
+
+	pkgs, err := packages.Load(&packages.Config{Mode: builder.LOAD_MODE}, "./...")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pkg := range pkgs {
+		for _, pkgErr := range pkg.Errors {
+			t.Errorf("generated code does not compile: %v", pkgErr)
+		}
+	}
+
+	// the nested setters of ext do not depend on ext being loaded along
+	stale, err := Check([]string{"./shop"}, KINDS, builder.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 0 {
+		t.Errorf("Check(./shop) after Generate(./...) = %v, want nothing stale", stale)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := useFixture(t)
+	if _, _, err := Generate([]string{"./..."}, KINDS, builder.Config{}); err != nil {
+		t.Fatal(err)
+	}
+
+	order := filepath.Join(dir, "shop", "order.go")
+	orderBuilder := filepath.Join(dir, "shop", "order_builder.go")
+	orderOptions := filepath.Join(dir, "shop", "order_options.go")
+	genericBuilder := filepath.Join(dir, "shop", "generic_builder.go")
+	genericAccessor := filepath.Join(dir, "shop", "generic_accessor.go")
+
+	// a hand edit, a lost file, a new builder version and a dropped directive
+	code, err := os.ReadFile(orderBuilder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(orderBuilder, append(code, "// edited\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(genericAccessor); err != nil {
+		t.Fatal(err)
+	}
+	code, err = os.ReadFile(genericBuilder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, rest, _ := strings.Cut(string(code), "\n")
+	words := strings.Fields(header)
+	words[5] = "v0.0.1-other"
+	if err := os.WriteFile(genericBuilder, []byte(strings.Join(words, " ")+"\n"+rest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	code, err = os.ReadFile(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(order, []byte(strings.Replace(string(code), "//builder:options\n", "", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stale, err := Check([]string{"./..."}, KINDS, builder.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(stale, func(i, j int) bool { return stale[i].Path < stale[j].Path })
+
+	want := []StaleFile{
+		{Path: genericAccessor, Reason: STALE_MISSING},
+		{Path: orderBuilder, Reason: STALE_CHANGED},
+		{Path: orderOptions, Reason: STALE_ORPHANED},
+	}
+	if len(stale) != len(want) {
+		t.Fatalf("Check() = %v, want %v", stale, want)
+	}
+	for i := range want {
+		if stale[i] != want[i] {
+			t.Errorf("Check() = %v, want %v", stale, want)
+			break
+		}
+	}
+}
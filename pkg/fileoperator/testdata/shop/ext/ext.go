@@ -0,0 +1,11 @@
+package ext
+
+type Address struct {
+	city string
+	zip  string
+}
+
+// Strict cannot be nested, since its Build returns an error.
+type Strict struct {
+	id string `build:",required"`
+}
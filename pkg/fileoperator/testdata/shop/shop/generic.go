@@ -0,0 +1,15 @@
+package shop
+
+//builder:equal
+//builder:clone
+type Page[diff any] struct {
+	items []diff
+	next  *Page[diff]
+}
+
+//builder:step
+type Account struct {
+	id    string `build:"ID,required"`
+	owner string `build:",required"`
+	note  string
+}
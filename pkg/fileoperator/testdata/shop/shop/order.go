@@ -0,0 +1,45 @@
+package shop
+
+import (
+	"errors"
+	"time"
+
+	"example.com/shop/ext"
+	"example.com/shop/other"
+)
+
+type audit struct {
+	createdBy string
+	createdAt time.Time
+}
+
+//builder:clone
+//builder:equal
+//builder:options
+//builder:validate
+type Order struct {
+	id      string `build:"ID,required" get:""`
+	lines   []Line
+	tags    []*other.Tag
+	labels  map[string]other.Tag
+	addr    ext.Address
+	addrs   []*ext.Address
+	strict  ext.Strict
+	retries int           `default:"3" get:"" set:""`
+	timeout time.Duration `default:"5 * time.Second"`
+	audit   `build:",flatten"`
+}
+
+func (o *Order) Validate() error {
+	if o.id == "" {
+		return errors.New("empty id")
+	}
+	return nil
+}
+
+//builder:clone
+//builder:equal
+type Line struct {
+	sku string
+	qty int
+}
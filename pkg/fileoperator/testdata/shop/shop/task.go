@@ -0,0 +1,8 @@
+package shop
+
+// Task keeps a field named after the builder tracker, which is fine without
+// required fields.
+type Task struct {
+	title    string
+	assigned string
+}
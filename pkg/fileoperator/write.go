@@ -0,0 +1,154 @@
+package fileoperator
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/arabian9ts/builder/pkg/builder"
+)
+
+// FILE_MODE is the mode of files created, existing ones keep theirs.
+const FILE_MODE = 0644
+
+type stagedFile struct {
+	GeneratedFile
+	tmp string
+}
+
+// replacement records a file moved aside by writePackage, to be put back when
+// a later step fails. backup is empty when there was no file before.
+type replacement struct {
+	path   string
+	backup string
+}
+
+// writePackage writes the files of a package all or nothing. each one is
+// staged in a temporary file next to its destination. once all of them are
+// staged, the current files are moved to backups and the staged ones renamed
+// into place, the orphaned files being backed up as well. when any step
+// fails, the backups are restored. files whose content is unchanged, but for
+// the builder version, are left alone, keeping their modification time for
+// build caches. it returns the files written.
+func writePackage(files []GeneratedFile, orphaned []string) ([]GeneratedFile, error) {
+	staged := make([]stagedFile, 0, len(files))
+	discard := func() {
+		for _, file := range staged {
+			os.Remove(file.tmp)
+		}
+	}
+
+	for _, file := range files {
+		current, err := os.ReadFile(file.Path)
+		if err == nil && builder.SameGenerated(string(current), file.Code) {
+			continue
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			discard()
+			return nil, err
+		}
+
+		mode := os.FileMode(FILE_MODE)
+		if info, err := os.Stat(file.Path); err == nil {
+			mode = info.Mode().Perm()
+		}
+		tmp, err := stageFile(file.Path, file.Code, mode)
+		if err != nil {
+			discard()
+			return nil, err
+		}
+		staged = append(staged, stagedFile{GeneratedFile: file, tmp: tmp})
+	}
+
+	done := make([]replacement, 0, len(staged)+len(orphaned))
+	rollback := func(err error) error {
+		for i := len(done) - 1; 0 <= i; i-- {
+			if done[i].backup == "" {
+				os.Remove(done[i].path)
+				continue
+			}
+			if restoreErr := os.Rename(done[i].backup, done[i].path); restoreErr != nil {
+				err = errors.Join(err, restoreErr)
+			}
+		}
+		discard()
+		return err
+	}
+
+	for _, file := range staged {
+		backup, err := backUp(file.Path)
+		if err != nil {
+			return nil, rollback(err)
+		}
+		done = append(done, replacement{path: file.Path, backup: backup})
+
+		if err := os.Rename(file.tmp, file.Path); err != nil {
+			return nil, rollback(err)
+		}
+	}
+	for _, fileName := range orphaned {
+		backup, err := backUp(fileName)
+		if err != nil {
+			return nil, rollback(err)
+		}
+		done = append(done, replacement{path: fileName, backup: backup})
+	}
+
+	for _, r := range done {
+		if r.backup != "" {
+			os.Remove(r.backup)
+		}
+	}
+
+	written := make([]GeneratedFile, 0, len(staged))
+	for _, file := range staged {
+		written = append(written, file.GeneratedFile)
+	}
+
+	return written, nil
+}
+
+// stageFile writes code to a temporary file in the directory of fileName,
+// hidden from the go command, and returns its path.
+func stageFile(fileName string, code string, mode os.FileMode) (string, error) {
+	fp, err := os.CreateTemp(filepath.Dir(fileName), "."+filepath.Base(fileName)+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = fp.WriteString(code)
+	if err == nil {
+		err = fp.Chmod(mode)
+	}
+	if closeErr := fp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(fp.Name())
+		return "", err
+	}
+
+	return fp.Name(), nil
+}
+
+// backUp moves fileName aside to a hidden file next to it and returns its
+// path, or "" when there is no such file.
+func backUp(fileName string) (string, error) {
+	if _, err := os.Lstat(fileName); errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+
+	fp, err := os.CreateTemp(filepath.Dir(fileName), "."+filepath.Base(fileName)+".*.bak")
+	if err != nil {
+		return "", err
+	}
+	backup := fp.Name()
+	fp.Close()
+
+	if err := os.Rename(fileName, backup); err != nil {
+		os.Remove(backup)
+		return "", err
+	}
+
+	return backup, nil
+}
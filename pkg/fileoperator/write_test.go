@@ -0,0 +1,131 @@
+package fileoperator
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+const (
+	OLD_CODE = "// Code generated by builder v1 from user.go. DO NOT EDIT.\n\npackage user\n"
+	NEW_CODE = "// Code generated by builder v2 from user.go. DO NOT EDIT.\n\npackage user\n\ntype UserBuilder struct{}\n"
+)
+
+func writeFile(t *testing.T, fileName string, content string, mode os.FileMode) {
+	t.Helper()
+
+	if err := os.WriteFile(fileName, []byte(content), mode); err != nil {
+		t.Fatal(err)
+	}
+	// WriteFile leaves the mode of existing files and is subject to umask
+	if err := os.Chmod(fileName, mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertFile(t *testing.T, fileName string, content string, mode os.FileMode) {
+	t.Helper()
+
+	got, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != content {
+		t.Errorf("%s holds %q, want %q", filepath.Base(fileName), got, content)
+	}
+	info, err := os.Stat(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != mode {
+		t.Errorf("%s has mode %v, want %v", filepath.Base(fileName), info.Mode().Perm(), mode)
+	}
+}
+
+// assertEntries checks that dir holds exactly names, with no temporary files
+// or backups left behind.
+func assertEntries(t *testing.T, dir string, names ...string) {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		got = append(got, entry.Name())
+	}
+	sort.Strings(names)
+	if len(got) != len(names) {
+		t.Fatalf("%s holds %q, want %q", dir, got, names)
+	}
+	for i := range got {
+		if got[i] != names[i] {
+			t.Fatalf("%s holds %q, want %q", dir, got, names)
+		}
+	}
+}
+
+func TestWritePackage(t *testing.T) {
+	dir := t.TempDir()
+	changed := filepath.Join(dir, "user_builder.go")
+	unchanged := filepath.Join(dir, "user_accessor.go")
+	created := filepath.Join(dir, "user_options.go")
+	orphaned := filepath.Join(dir, "gone_builder.go")
+	writeFile(t, changed, OLD_CODE, 0600)
+	writeFile(t, unchanged, OLD_CODE, 0640)
+	writeFile(t, orphaned, OLD_CODE, 0644)
+
+	// the accessor differs in the builder version only
+	written, err := writePackage([]GeneratedFile{
+		{Kind: BUILDER_KIND, Path: changed, Code: NEW_CODE},
+		{Kind: ACCESSOR_KIND, Path: unchanged, Code: "// Code generated by builder v2 from user.go. DO NOT EDIT.\n\npackage user\n"},
+		{Kind: OPTIONS_KIND, Path: created, Code: NEW_CODE},
+	}, []string{orphaned})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := make([]string, 0, len(written))
+	for _, file := range written {
+		paths = append(paths, file.Path)
+	}
+	if len(paths) != 2 || paths[0] != changed || paths[1] != created {
+		t.Errorf("writePackage() wrote %q, want %q", paths, []string{changed, created})
+	}
+	assertFile(t, changed, NEW_CODE, 0600)
+	assertFile(t, unchanged, OLD_CODE, 0640)
+	assertFile(t, created, NEW_CODE, FILE_MODE)
+	assertEntries(t, dir, "user_builder.go", "user_accessor.go", "user_options.go")
+}
+
+func TestWritePackageRollback(t *testing.T) {
+	dir := t.TempDir()
+	changed := filepath.Join(dir, "user_builder.go")
+	created := filepath.Join(dir, "user_options.go")
+	orphaned := filepath.Join(dir, "gone_builder.go")
+	writeFile(t, changed, OLD_CODE, 0600)
+
+	// a directory cannot be renamed over its backup file, so removing the
+	// orphan fails once the other files have been replaced
+	if err := os.Mkdir(orphaned, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(orphaned, "keep.go"), OLD_CODE, 0644)
+
+	_, err := writePackage([]GeneratedFile{
+		{Kind: BUILDER_KIND, Path: changed, Code: NEW_CODE},
+		{Kind: OPTIONS_KIND, Path: created, Code: NEW_CODE},
+	}, []string{orphaned})
+	if err == nil {
+		t.Fatal("writePackage() succeeds, want an error")
+	}
+
+	assertFile(t, changed, OLD_CODE, 0600)
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Errorf("%s is left behind: %v", filepath.Base(created), err)
+	}
+	assertFile(t, filepath.Join(orphaned, "keep.go"), OLD_CODE, 0644)
+	assertEntries(t, dir, "user_builder.go", "gone_builder.go")
+}